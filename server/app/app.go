@@ -2,14 +2,18 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/myodc/playground-server/server/docker"
+	"github.com/myodc/playground-server/server/domain"
 	"github.com/myodc/playground-server/server/events"
-	"github.com/myodc/playground-server/server/kubernetes"
+	"github.com/myodc/playground-server/server/runtime"
 	"github.com/myodc/playground-server/server/store"
 	log "github.com/cihub/seelog"
 )
@@ -18,12 +22,32 @@ var (
 	baseImage       = `FROM myodc/playground-base`
 	namespace       = "playground:apps"
 	statusNamespace = "playground:apps:status"
+	releaseFormat   = "20060102150405"
 	nameRe          = regexp.MustCompilePOSIX("^[a-z][a-z0-9-]+")
+	namespaceRe     = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+	// runtime services of started apps
+	endpointNamespace = "playground:apps:endpoints"
+
+	// ErrStaleRevision is returned when an app is updated from
+	// a revision which is no longer the latest
+	ErrStaleRevision = errors.New("App has been changed since the revision given")
+
+	errUnchanged = errors.New("App unchanged")
 )
 
+// ValidationError is returned for an app or change which is invalid
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
 func Create(app *App) error {
 	if !nameRe.MatchString(app.Id) {
-		return fmt.Errorf("App Id invalid. Must match %s", nameRe.String())
+		return &ValidationError{fmt.Errorf("App Id invalid. Must match %s", nameRe.String())}
 	}
 
 	exists, err := store.Exists(namespace, app.Id)
@@ -35,24 +59,137 @@ func Create(app *App) error {
 		return fmt.Errorf("App already exists")
 	}
 
-	if err := Update(app); err != nil {
+	// the app and its first status are saved together, a
+	// concurrent create of the same id fails as stale
+	batch := store.NewBatch()
+	info, err := app.createdStatus(batch)
+	if err != nil {
+		return err
+	}
+
+	app.Revision = 0
+	if err := update(app, batch); err != nil {
 		return err
 	}
 
-	return app.UpdateStatus(&Info{AppId: app.Id, Status: "Created", Timestamp: time.Now()})
+	return app.statusChanged(info)
 }
 
+// Update saves an app. An app with a revision set must still be at
+// that revision in the store, or ErrStaleRevision is returned. The
+// revision is then incremented and Created kept from the stored app.
 func Update(app *App) error {
+	return update(app, store.NewBatch())
+}
+
+// update saves an app along with the other writes in batch
+func update(app *App, batch *store.Batch) error {
+	if err := validate(app); err != nil {
+		return &ValidationError{err}
+	}
+
+	old, err := store.Get(namespace, app.Id)
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	revision := app.Revision
+	created := app.Created
+
+	if old != nil {
+		var current *App
+		if err := json.Unmarshal(old, &current); err != nil {
+			return err
+		}
+		if app.Revision > 0 && app.Revision != current.Revision {
+			return ErrStaleRevision
+		}
+		app.Created = current.Created
+		app.Revision = current.Revision + 1
+	} else {
+		if app.Revision > 0 {
+			return ErrStaleRevision
+		}
+		app.Created = time.Now()
+		app.Revision = 1
+	}
+
+	// private images are mirrored into the server's registry on build
+	if len(app.Source.Image) > 0 {
+		if !docker.Private(app.Source.Image) {
+			app.Image = app.Source.Image
+		} else if !docker.Local(app.imageName()) {
+			return &ValidationError{fmt.Errorf("Private images can only be mirrored into the server registry")}
+		}
+	}
+
+	app.Updated = time.Now()
+
+	b, err := json.Marshal(app)
+	if err != nil {
+		return err
+	}
+
+	ok, err := batch.Put(namespace, app.Id, b).ExecIf(namespace, app.Id, old)
+	if err == nil && !ok {
+		err = ErrStaleRevision
+	}
+
+	if err != nil {
+		app.Revision = revision
+		app.Created = created
+	}
+
+	return err
+}
+
+// modify changes the stored app, retrying if it is updated by
+// someone else in the meantime. Returning errUnchanged from fn
+// leaves the app as it is.
+func modify(id string, fn func(a *App) error) (*App, error) {
+	for i := 0; i < maxStatusRetries; i++ {
+		a, err := Read(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fn(a); err == errUnchanged {
+			return a, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if err := Update(a); err != ErrStaleRevision {
+			return a, err
+		}
+	}
+
+	return nil, ErrStaleRevision
+}
+
+// validate checks an app and fills in config defaults
+func validate(app *App) error {
 	if !nameRe.MatchString(app.Id) {
 		return fmt.Errorf("App Id invalid. Must match %s", nameRe.String())
 	}
 
+	// the host an app is served under can't be one of the server
+	if proxyDomain := os.Getenv("PLAYGROUND_PROXY_DOMAIN"); len(proxyDomain) > 0 && domain.Server(app.Id+"."+proxyDomain) {
+		return fmt.Errorf("App Id %s is reserved", app.Id)
+	}
+
 	if app.Source == nil {
 		return fmt.Errorf("App source not set")
 	}
 
-	if app.Created.IsZero() {
-		app.Created = time.Now()
+	if err := validateNamespace(app); err != nil {
+		return err
+	}
+
+	if app.Source.GitRepo != nil {
+		if err := validateGitRepo(app.Source.GitRepo); err != nil {
+			return err
+		}
 	}
 
 	if app.Config == nil {
@@ -62,24 +199,172 @@ func Update(app *App) error {
 		}
 	}
 
-	if len(app.Source.Image) > 0 {
-		app.Image = app.Source.Image
+	if err := validatePorts(app.Config); err != nil {
+		return err
 	}
 
-	app.Updated = time.Now()
+	if err := validateVolumes(app.Config.Volumes); err != nil {
+		return err
+	}
 
-	b, err := json.Marshal(app)
-	if err != nil {
+	if err := validateResources(app.Config); err != nil {
 		return err
 	}
 
-	return store.Put(namespace, app.Id, b)
+	if err := validateHealthCheck(app.Config.HealthCheck); err != nil {
+		return err
+	}
+
+	if err := validateAutoscale(app.Config); err != nil {
+		return err
+	}
+
+	if err := validateJob(app.Config); err != nil {
+		return err
+	}
+
+	if err := validatePreviews(app); err != nil {
+		return err
+	}
+
+	return validateEnv(app.Config.Env)
+}
+
+// namespaceAllowed returns true for the namespaces listed in
+// PLAYGROUND_NAMESPACES, or those starting with PLAYGROUND_NAMESPACE_PREFIX,
+// playground- by default, so apps can't be placed in system namespaces
+func namespaceAllowed(ns string) bool {
+	if list := os.Getenv("PLAYGROUND_NAMESPACES"); len(list) > 0 {
+		for _, allowed := range strings.Split(list, ",") {
+			if strings.TrimSpace(allowed) == ns {
+				return true
+			}
+		}
+	}
+
+	prefix := os.Getenv("PLAYGROUND_NAMESPACE_PREFIX")
+	if len(prefix) == 0 {
+		prefix = "playground-"
+	}
+
+	return strings.HasPrefix(ns, prefix) && len(ns) > len(prefix)
+}
+
+// validateNamespace checks the namespace is a valid name which apps
+// may use, and that a running app or one with volumes is not moved
+// to another namespace
+func validateNamespace(app *App) error {
+	if len(app.Namespace) > 0 && (len(app.Namespace) > 63 || !namespaceRe.MatchString(app.Namespace)) {
+		return fmt.Errorf("App namespace invalid. Must match %s", namespaceRe.String())
+	}
+
+	// apps already placed in a namespace stay usable
+	old, err := Read(app.Id)
+	if err == nil && old.Namespace == app.Namespace {
+		return nil
+	}
+
+	if len(app.Namespace) > 0 && !namespaceAllowed(app.Namespace) {
+		return fmt.Errorf("App namespace %s not allowed", app.Namespace)
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	if status, err := Status(app.Id); err == nil && isUp(status.Status) {
+		return fmt.Errorf("App must be stopped to change its namespace")
+	}
+
+	// volumes live in the namespace and would be left behind
+	if old.Config != nil && len(old.Config.Volumes) > 0 {
+		return fmt.Errorf("App has volumes and cannot change its namespace")
+	}
+
+	return nil
 }
 
-func Delete(id string) error {
+// namespaceOf returns the namespace of an app for the runtime
+func namespaceOf(id string) string {
+	a, err := Read(id)
+	if err != nil {
+		return ""
+	}
+	return a.Namespace
+}
+
+// Delete removes an app. Volumes are kept unless purge is set.
+// The app is marked Deleting first so nothing else acts on it, and
+// its record is only removed once the runtime and the rest of its
+// state are cleaned up, so a failed delete can be retried.
+func Delete(id string, purge bool) error {
+	a, err := Read(id)
+	switch {
+	case err == store.ErrNotFound:
+		a = &App{Id: id}
+	case err != nil:
+		return err
+	}
+
+	if err := a.UpdateStatus(&Info{
+		Status:  StatusDeleting,
+		Reason:  "Delete executed",
+		Message: "Deleting app",
+	}); err != nil {
+		return err
+	}
+
 	// Remove running app
-	kubernetes.Delete(id)
-	return store.Del(namespace, id)
+	unwatchHealth(id)
+	if err := getRuntime().Delete(id); err != nil {
+		return err
+	}
+
+	// Stop job runs and remove their history
+	if err := removeJob(id); err != nil {
+		log.Errorf("Error removing runs for %s: %v", id, err)
+	}
+
+	// Remove branch previews of the app
+	if err := removePreviews(id); err != nil {
+		log.Errorf("Error removing previews of %s: %v", id, err)
+	}
+
+	// Drop the app from its stack
+	if err := leaveStack(id); err != nil {
+		log.Errorf("Error removing %s from its stack: %v", id, err)
+	}
+
+	// Release custom domains
+	if err := domain.DeleteApp(id); err != nil {
+		log.Errorf("Error removing domains for %s: %v", id, err)
+	}
+
+	if a.Config != nil {
+		// Unbind backing services
+		releaseServices(a)
+
+		// Mark images for garbage collection
+		if err := docker.Forget(a.imageName()); err != nil {
+			log.Errorf("Error releasing images for %s: %v", id, err)
+		}
+	}
+
+	// Remove persistent data
+	if purge {
+		if err := getRuntime().DeleteVolumes(id); err != nil {
+			return err
+		}
+	}
+
+	// Remove the app and its status and timeline together
+	batch := store.NewBatch().
+		Del(namespace, id).
+		Del(statusNamespace, id).
+		Del(endpointNamespace, id)
+	removeHistory(batch, id)
+
+	return batch.Exec()
 }
 
 func Read(id string) (*App, error) {
@@ -112,8 +397,24 @@ func List(offset, limit int) ([]*App, error) {
 	return apps, nil
 }
 
-func Logs(id, container string, out io.Writer) error {
-	return kubernetes.Logs(id, container, out)
+// Logs writes the logs of an app. A blank instance in opts
+// aggregates the logs of all instances.
+func Logs(id string, opts *runtime.LogOptions, out io.Writer) error {
+	return getRuntime().Logs(id, opts, out)
+}
+
+// Instances lists the running replicas of an app
+func Instances(id string) ([]*runtime.Instance, error) {
+	exists, err := store.Exists(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("Does not exist")
+	}
+
+	return getRuntime().Instances(id)
 }
 
 func Status(id string) (*Info, error) {
@@ -158,12 +459,14 @@ func (a *App) Build() error {
 		return fmt.Errorf("App source does not exist")
 	}
 
-	// update status
-	a.UpdateStatus(&Info{
-		Status:  "Building",
+	// update status, refused while the app is busy
+	if err := a.UpdateStatus(&Info{
+		Status:  StatusBuilding,
 		Reason:  "Build executed",
 		Message: "Building image for app",
-	})
+	}); err != nil {
+		return err
+	}
 
 	var err error
 	switch {
@@ -173,11 +476,13 @@ func (a *App) Build() error {
 		err = buildGitRepo(a)
 	case len(a.Source.Dockerfile) > 0:
 		err = buildDockerFile(a)
+	case len(a.Source.Image) > 0 && docker.Private(a.Source.Image):
+		err = mirrorImage(a)
 	case len(a.Source.Image) > 0:
 		a.Image = a.Source.Image
 		// update status
 		a.UpdateStatus(&Info{
-			Status:  "Built",
+			Status:  StatusBuilt,
 			Reason:  "Build executed",
 			Message: "Build not needed, image specified",
 		})
@@ -185,7 +490,7 @@ func (a *App) Build() error {
 	default:
 		// update status
 		a.UpdateStatus(&Info{
-			Status:  "Failed",
+			Status:  StatusFailed,
 			Reason:  "Invalid source",
 			Message: "Invalid Source specified for app",
 		})
@@ -193,24 +498,47 @@ func (a *App) Build() error {
 	}
 
 	if err != nil {
+		// update status
+		a.UpdateStatus(&Info{
+			Status:  StatusFailed,
+			Reason:  err.Error(),
+			Message: "Failed to build image",
+		})
+		return err
+	}
+
+	// tag the build as a new release, latest stays as the cache source
+	release := time.Now().UTC().Format(releaseFormat)
+	if err := docker.Tag(a.imageName()+":latest", a.imageName(), release); err != nil {
+		a.UpdateStatus(&Info{
+			Status:  StatusFailed,
+			Reason:  err.Error(),
+			Message: "Failed to tag release",
+		})
 		return err
 	}
 
-	a.Image = fmt.Sprintf("%s:%s", docker.Image(a.Id), "latest")
+	a.Image = fmt.Sprintf("%s:%s", a.imageName(), release)
 
-	if err := Update(a); err != nil {
+	// only set the image so changes made during the build are kept
+	updated, err := modify(a.Id, func(current *App) error {
+		current.Image = a.Image
+		return nil
+	})
+	if err != nil {
 		// update status
 		a.UpdateStatus(&Info{
-			Status:  "Failed",
+			Status:  StatusFailed,
 			Reason:  err.Error(),
 			Message: "Failed to update app state",
 		})
 		return err
 	}
+	a.Revision = updated.Revision
 
 	// update status
 	a.UpdateStatus(&Info{
-		Status:  "Built",
+		Status:  StatusBuilt,
 		Reason:  "Build executed",
 		Message: "Built image for app",
 	})
@@ -218,6 +546,38 @@ func (a *App) Build() error {
 	return nil
 }
 
+// Images returns the releases deployed or pinned by apps, which
+// are kept by image garbage collection
+func Images() ([]string, error) {
+	apps, err := List(0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, a := range apps {
+		if len(a.Image) > 0 {
+			images = append(images, a.Image)
+		}
+	}
+	return images, nil
+}
+
+// imageName returns the repository the app's images are built as
+func (a *App) imageName() string {
+	if a.Config == nil {
+		return docker.Image(a.Id)
+	}
+	return docker.ImageFor(a.Config.Registry, a.Config.Repository, a.Id)
+}
+
+// warmCache pulls the previous image for an app so the build can reuse its layers
+func warmCache(a *App, out io.Writer) {
+	if err := docker.Warm(a.imageName(), "latest", out); err != nil {
+		log.Debugf("No previous image for %s to use as cache: %v", a.Id, err)
+	}
+}
+
 // Push sends the image to the docker registry
 func (a *App) Push() error {
 	if len(a.Image) == 0 {
@@ -228,36 +588,43 @@ func (a *App) Push() error {
 		return fmt.Errorf("App source does not exist")
 	}
 
-	// Don't push when the source is an image
-	if len(a.Source.Image) > 0 {
+	// Don't push when the source is a public image
+	if a.Image == a.Source.Image {
 		return nil
 	}
 
+	// update status
+	if err := a.UpdateStatus(&Info{
+		Status:  StatusPushing,
+		Reason:  "Push executed",
+		Message: "Pushing to registry",
+	}); err != nil {
+		return err
+	}
+
 	in, out := io.Pipe()
 
 	// make the output available for streaming
 	go events.Receive(a.Id, in)
 
-	// update status
-	a.UpdateStatus(&Info{
-		Status:  "Pushing",
-		Reason:  "Push executed",
-		Message: "Pushing to registry",
-	})
-
-	if err := docker.Push(a.Id, "latest", true, out); err != nil {
-		// update status
-		a.UpdateStatus(&Info{
-			Status:  "Failed",
-			Reason:  err.Error(),
-			Message: "Failed pushing to registry",
-		})
-		return err
+	image, release := docker.SplitImage(a.Image)
+
+	// keep the local images as a cache source for the next build
+	for _, tag := range []string{release, "latest"} {
+		if err := docker.Push(image, tag, false, out); err != nil {
+			// update status
+			a.UpdateStatus(&Info{
+				Status:  StatusFailed,
+				Reason:  err.Error(),
+				Message: "Failed pushing to registry",
+			})
+			return err
+		}
 	}
 
 	// update status
 	a.UpdateStatus(&Info{
-		Status:  "Pushed",
+		Status:  StatusPushed,
 		Reason:  "Push executed",
 		Message: "Pushed to registry",
 	})
@@ -270,62 +637,111 @@ func (a *App) Restart() error {
 	return a.Start()
 }
 
-// Start pushes the build into kubernetes
-func (a *App) Start() error {
-	if len(a.Image) == 0 {
-		return fmt.Errorf("App image not set")
+// Reload restarts an app which is up so it picks up changes
+// to its env, apps which are not up are left as they are
+func (a *App) Reload() error {
+	status, err := Status(a.Id)
+	if err != nil || !isUp(status.Status) {
+		return err
 	}
+	return a.Restart()
+}
 
-	// update status
-	a.UpdateStatus(&Info{
-		Status:  "Starting",
-		Reason:  "Start executed",
-		Message: "Starting app",
-	})
-
-	// start service
-	service, err := kubernetes.Create(a.Id, &kubernetes.ContainerConfig{
+// containerConfig returns what the runtime runs the app's build with
+func (a *App) containerConfig() *runtime.ContainerConfig {
+	return &runtime.ContainerConfig{
 		ContainerPort: a.Config.ContainerPort,
+		Ports:         a.Config.Ports,
+		Volumes:       a.Config.Volumes,
+		Resources:     a.Config.Resources,
+		Env:           a.env(),
 		Image:         a.Image,
 		NumInstances:  a.Config.NumInstances,
+		HealthCheck:   a.Config.HealthCheck,
 		Labels: map[string]string{
 			"name":  a.Id,
 			"type":  "playground",
 			"proxy": "true",
 		},
-	})
+	}
+}
+
+// Start deploys the build to the runtime
+func (a *App) Start() error {
+	if len(a.Image) == 0 {
+		return fmt.Errorf("App image not set")
+	}
+
+	if a.Config.Job != nil {
+		return fmt.Errorf("App is a job, trigger a run instead")
+	}
+
+	// update status
+	if err := a.UpdateStatus(&Info{
+		Status:  StatusStarting,
+		Reason:  "Start executed",
+		Message: "Starting app",
+	}); err != nil {
+		return err
+	}
+
+	// start service
+	service, err := getRuntime().Create(a.Id, a.containerConfig())
 	if err != nil {
 		a.UpdateStatus(&Info{
-			Status:  "Failed",
+			Status:  StatusFailed,
 			Reason:  err.Error(),
 			Message: "Failed to start app",
 		})
 		return err
 	}
 
+	// record where the app can be reached
+	if err := saveEndpoint(a.Id, service); err != nil {
+		log.Errorf("Error saving endpoint for %s: %v", a.Id, err)
+	}
+
 	// update status
 	a.UpdateStatus(&Info{
-		Status:  "Started",
+		Status:  StatusStarted,
 		Reason:  "Start executed",
 		Message: fmt.Sprintf("App has been started: %v", *service),
 	})
 
+	// moves the app to running once healthy
+	watchHealth(a, StatusStarted)
+
+	// defer to the runtime's autoscaler if it has one
+	if as, ok := getRuntime().(runtime.Autoscaler); ok && a.Config.Autoscale != nil {
+		if err := as.Autoscale(a.Id, a.Config.Autoscale); err != nil {
+			log.Errorf("Error setting autoscaler for %s: %v", a.Id, err)
+		}
+	}
+
 	return nil
 }
 
-// Remove deletes a build running on kubernetes
+// Remove deletes a build running on the runtime
 func (a *App) Stop() error {
 	// update status
-	a.UpdateStatus(&Info{
-		Status:  "Stopping",
+	if err := a.UpdateStatus(&Info{
+		Status:  StatusStopping,
 		Reason:  "Stop executed",
 		Message: "Stopping app",
-	})
+	}); err != nil {
+		return err
+	}
+
+	unwatchHealth(a.Id)
 
 	// start service
-	if err := kubernetes.Delete(a.Id); err != nil {
+	if err := store.Del(endpointNamespace, a.Id); err != nil {
+		log.Errorf("Error removing endpoint for %s: %v", a.Id, err)
+	}
+
+	if err := getRuntime().Delete(a.Id); err != nil {
 		a.UpdateStatus(&Info{
-			Status:  "Failed",
+			Status:  StatusFailed,
 			Reason:  err.Error(),
 			Message: "Failed to stop app",
 		})
@@ -334,23 +750,10 @@ func (a *App) Stop() error {
 
 	// update status
 	a.UpdateStatus(&Info{
-		Status:  "Stopped",
+		Status:  StatusStopped,
 		Reason:  "Stop executed",
 		Message: "App has been stopped",
 	})
 
 	return nil
 }
-
-// Update Status
-func (a *App) UpdateStatus(info *Info) error {
-	info.AppId = a.Id
-	info.Timestamp = time.Now()
-
-	b, err := json.Marshal(info)
-	if err != nil {
-		return err
-	}
-	events.Send(a.Id, events.Event{Body: info.Status, Type: events.Status})
-	return store.Put(statusNamespace, a.Id, b)
-}
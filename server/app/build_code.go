@@ -3,11 +3,11 @@ package app
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 
+	"github.com/myodc/playground-server/server/cache"
 	"github.com/myodc/playground-server/server/docker"
 	"github.com/myodc/playground-server/server/events"
 	"github.com/myodc/playground-server/server/lang"
@@ -15,11 +15,20 @@ import (
 
 func buildCode(app *App) error {
 	// TODO: create a build status updater of some kind
-	dir, err := ioutil.TempDir("", "playground")
+	cacheDir, err := cache.Acquire(app.Id, app.imageName())
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(dir)
+	defer cache.Release(app.Id)
+
+	// the context is rewritten each build, the image cache does the rest
+	dir := filepath.Join(cacheDir, "code")
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
 
 	// Write Dockefile
 	dockerFile := filepath.Join(dir, "Dockerfile")
@@ -59,6 +68,9 @@ func buildCode(app *App) error {
 	// make the output available for streaming
 	go events.Receive(app.Id, in)
 
+	// seed the layer cache with the previous image
+	warmCache(app, out)
+
 	// blocking
-	return docker.Build(app.Id, "latest", dir, out)
+	return docker.Build(app.imageName(), "latest", dir, out)
 }
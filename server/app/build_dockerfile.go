@@ -2,20 +2,25 @@ package app
 
 import (
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	"github.com/myodc/playground-server/server/cache"
 	"github.com/myodc/playground-server/server/docker"
 	"github.com/myodc/playground-server/server/events"
 )
 
 func buildDockerFile(app *App) error {
-	dir, err := ioutil.TempDir("", "playground")
+	cacheDir, err := cache.Acquire(app.Id, app.imageName())
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(dir)
+	defer cache.Release(app.Id)
+
+	dir := filepath.Join(cacheDir, "dockerfile")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
 
 	// Write Dockefile
 	dockerFile := filepath.Join(dir, "Dockerfile")
@@ -35,6 +40,9 @@ func buildDockerFile(app *App) error {
 	// make the output available for streaming
 	go events.Receive(app.Id, in)
 
+	// seed the layer cache with the previous image
+	warmCache(app, out)
+
 	// blocking
-	return docker.Build(app.Id, "latest", dir, out)
+	return docker.Build(app.imageName(), "latest", dir, out)
 }
@@ -3,11 +3,12 @@ package app
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
+	"github.com/myodc/playground-server/server/cache"
 	"github.com/myodc/playground-server/server/docker"
 	"github.com/myodc/playground-server/server/events"
 )
@@ -15,18 +16,17 @@ import (
 func buildGitRepo(app *App) error {
 	// TODO: create a build status updater of some kind
 
-	dir, err := ioutil.TempDir("", "playground")
-	if err != nil {
+	if err := validateGitRepo(app.Source.GitRepo); err != nil {
 		return err
 	}
-	defer os.RemoveAll(dir)
-
-	repo := filepath.Join(dir, "repo")
 
-	// check url
-	if len(app.Source.GitRepo.Url) == 0 {
-		return fmt.Errorf("Git URL cannot be blank")
+	cacheDir, err := cache.Acquire(app.Id, app.imageName())
+	if err != nil {
+		return err
 	}
+	defer cache.Release(app.Id)
+
+	repo := filepath.Join(cacheDir, "repo")
 
 	branch := app.Source.GitRepo.Branch
 	if len(branch) == 0 {
@@ -35,17 +35,93 @@ func buildGitRepo(app *App) error {
 
 	in, out := io.Pipe()
 
-	cmd := exec.Command("git", "clone", "-b", branch, app.Source.GitRepo.Url, repo)
-	cmd.Stdout = out
-	cmd.Stderr = out
-
 	// make the output available for streaming
 	go events.Receive(app.Id, in)
 
-	if err := cmd.Run(); err != nil {
+	if err := syncRepo(app.Source.GitRepo.Url, branch, repo, out); err != nil {
 		return err
 	}
 
+	// seed the layer cache with the previous image
+	warmCache(app, out)
+
 	// blocking
-	return docker.Build(app.Id, "latest", repo, out)
+	return docker.Build(app.imageName(), "latest", repo, out)
+}
+
+// validateGitRepo checks the url and branch can't be taken as
+// options by git
+func validateGitRepo(repo *GitRepo) error {
+	if len(repo.Url) == 0 {
+		return fmt.Errorf("Git URL cannot be blank")
+	}
+
+	if strings.HasPrefix(repo.Url, "-") {
+		return fmt.Errorf("Invalid git URL %s", repo.Url)
+	}
+
+	if len(repo.Branch) == 0 {
+		return nil
+	}
+
+	return ValidBranch(repo.Branch)
+}
+
+// ValidBranch checks a branch name is one git accepts
+func ValidBranch(branch string) error {
+	if len(branch) == 0 || strings.HasPrefix(branch, "-") {
+		return fmt.Errorf("Invalid branch %s", branch)
+	}
+
+	if err := exec.Command("git", "check-ref-format", "--branch", branch).Run(); err != nil {
+		return fmt.Errorf("Invalid branch %s", branch)
+	}
+
+	return nil
+}
+
+// syncRepo fetches into an existing clone or clones from scratch
+func syncRepo(url, branch, repo string, out io.Writer) error {
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err == nil {
+		err := fetchRepo(url, branch, repo, out)
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintf(out, "Fetch failed, cloning again: %v\n", err)
+	}
+
+	if err := os.RemoveAll(repo); err != nil {
+		return err
+	}
+
+	return git(out, "", "clone", "-b", branch, "--", url, repo)
+}
+
+func fetchRepo(url, branch, repo string, out io.Writer) error {
+	// the url may have changed since the last build
+	b, err := exec.Command("git", "-C", repo, "config", "--get", "remote.origin.url").Output()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(b)) != url {
+		if err := git(out, repo, "remote", "set-url", "--", "origin", url); err != nil {
+			return err
+		}
+	}
+
+	if err := git(out, repo, "fetch", "--", "origin", branch); err != nil {
+		return err
+	}
+	if err := git(out, repo, "checkout", "-f", "-B", branch, "FETCH_HEAD"); err != nil {
+		return err
+	}
+	return git(out, repo, "clean", "-fdx")
+}
+
+func git(out io.Writer, dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
 }
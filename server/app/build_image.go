@@ -0,0 +1,34 @@
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/myodc/playground-server/server/docker"
+	"github.com/myodc/playground-server/server/events"
+)
+
+// mirrorImage pulls a private source image with the configured
+// credentials and tags it into the app's target repository so the
+// cluster can pull it without access to the credentials. The target
+// must be the server's registry so images can't be copied elsewhere.
+func mirrorImage(app *App) error {
+	if !docker.Local(app.imageName()) {
+		return fmt.Errorf("Private images can only be mirrored into the server registry")
+	}
+
+	in, out := io.Pipe()
+	defer out.Close()
+
+	// make the output available for streaming
+	go events.Receive(app.Id, in)
+
+	image, tag := docker.SplitImage(app.Source.Image)
+
+	// blocking
+	if err := docker.Pull(image, tag, out); err != nil {
+		return err
+	}
+
+	return docker.Tag(docker.Reference(image, tag), app.imageName(), "latest")
+}
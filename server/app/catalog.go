@@ -0,0 +1,124 @@
+package app
+
+import (
+	"os"
+	"sort"
+)
+
+// ServiceTemplate is a backing service which can be provisioned.
+// Env, URL and Bind are expanded with $HOST, $PORT and $PASSWORD.
+type ServiceTemplate struct {
+	Name        string
+	Description string
+	Image       string
+	Port        int
+	// Mount path of the data volume, blank to keep no data
+	DataPath string `json:",omitempty"`
+	// Env of the service's container
+	Env map[string]string `json:"-"`
+	// Connection URL, also set as <SERVICE>_URL in bound apps
+	URL string `json:"-"`
+	// Env set in bound apps
+	Bind map[string]string `json:"-"`
+}
+
+var catalog = map[string]*ServiceTemplate{
+	"redis": {
+		Name:        "redis",
+		Description: "Redis key value store",
+		Image:       "redis:7",
+		Port:        6379,
+		DataPath:    "/data",
+		URL:         "redis://$HOST:$PORT",
+		Bind: map[string]string{
+			"REDIS_URL":  "$URL",
+			"REDIS_HOST": "$HOST",
+			"REDIS_PORT": "$PORT",
+		},
+	},
+	"memcached": {
+		Name:        "memcached",
+		Description: "Memcached cache",
+		Image:       "memcached:1.6",
+		Port:        11211,
+		URL:         "memcached://$HOST:$PORT",
+		Bind: map[string]string{
+			"MEMCACHED_SERVERS": "$HOST:$PORT",
+		},
+	},
+	"postgres": {
+		Name:        "postgres",
+		Description: "PostgreSQL database",
+		Image:       "postgres:16",
+		Port:        5432,
+		DataPath:    "/var/lib/postgresql/data",
+		Env: map[string]string{
+			"POSTGRES_USER":     "playground",
+			"POSTGRES_PASSWORD": "$PASSWORD",
+			"POSTGRES_DB":       "playground",
+			// the volume root holds lost+found on some storage
+			"PGDATA": "/var/lib/postgresql/data/pgdata",
+		},
+		URL: "postgres://playground:$PASSWORD@$HOST:$PORT/playground?sslmode=disable",
+		Bind: map[string]string{
+			"DATABASE_URL": "$URL",
+			"PGHOST":       "$HOST",
+			"PGPORT":       "$PORT",
+			"PGUSER":       "playground",
+			"PGPASSWORD":   "$PASSWORD",
+			"PGDATABASE":   "playground",
+		},
+	},
+	"mysql": {
+		Name:        "mysql",
+		Description: "MySQL database",
+		Image:       "mysql:8",
+		Port:        3306,
+		DataPath:    "/var/lib/mysql",
+		Env: map[string]string{
+			"MYSQL_USER":                 "playground",
+			"MYSQL_PASSWORD":             "$PASSWORD",
+			"MYSQL_DATABASE":             "playground",
+			"MYSQL_RANDOM_ROOT_PASSWORD": "yes",
+		},
+		URL: "mysql://playground:$PASSWORD@$HOST:$PORT/playground",
+		Bind: map[string]string{
+			"DATABASE_URL":   "$URL",
+			"MYSQL_HOST":     "$HOST",
+			"MYSQL_PORT":     "$PORT",
+			"MYSQL_USER":     "playground",
+			"MYSQL_PASSWORD": "$PASSWORD",
+			"MYSQL_DATABASE": "playground",
+		},
+	},
+}
+
+// Catalog lists the services which can be provisioned
+func Catalog() []*ServiceTemplate {
+	var names []string
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var templates []*ServiceTemplate
+	for _, name := range names {
+		templates = append(templates, catalog[name])
+	}
+	return templates
+}
+
+// expand fills in a template value from vars
+func expand(s string, vars map[string]string) string {
+	return os.Expand(s, func(key string) string {
+		return vars[key]
+	})
+}
+
+func expandEnv(env, vars map[string]string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range env {
+		out[k] = expand(v, vars)
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"encoding/json"
+
+	"github.com/myodc/playground-server/server/runtime"
+	"github.com/myodc/playground-server/server/store"
+)
+
+func saveEndpoint(id string, service *runtime.Service) error {
+	b, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	return store.Put(endpointNamespace, id, b)
+}
+
+// Endpoint returns the service address of a started app
+func Endpoint(id string) (*runtime.Service, error) {
+	b, err := store.Get(endpointNamespace, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var service *runtime.Service
+	if err := json.Unmarshal(b, &service); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
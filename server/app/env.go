@@ -0,0 +1,60 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+
+	log "github.com/cihub/seelog"
+)
+
+var (
+	envNameRe = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+)
+
+func validateEnv(env map[string]string) error {
+	for name := range env {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("Env var name %q invalid. Must match %s", name, envNameRe.String())
+		}
+	}
+	return nil
+}
+
+// env returns the env vars of an app's containers, the addresses
+// of the apps it depends on in its stack, the connection details of
+// its bound services and its own config
+func (a *App) env() map[string]string {
+	env := make(map[string]string)
+
+	if s, err := stackOf(a.Id); err == nil {
+		if m := s.member(a.Id); m != nil {
+			for _, dep := range m.DependsOn {
+				service, err := Endpoint(dep)
+				if err != nil {
+					log.Errorf("No address of %s for %s: %v", dep, a.Id, err)
+					continue
+				}
+				for k, v := range discoveryEnv(dep, service) {
+					env[k] = v
+				}
+			}
+		}
+	}
+
+	for _, id := range a.Config.Services {
+		vars, err := serviceEnv(id)
+		if err != nil {
+			log.Errorf("No connection details of %s for %s: %v", id, a.Id, err)
+			continue
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+	}
+
+	for k, v := range a.Config.Env {
+		env[k] = v
+	}
+
+	return env
+}
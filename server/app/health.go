@@ -0,0 +1,152 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	healthMtx sync.Mutex
+	watchers  = make(map[string]chan bool)
+
+	// grace period for apps without health checks
+	defaultGrace = time.Minute
+)
+
+func validateHealthCheck(hc *runtime.HealthCheck) error {
+	if hc == nil {
+		return nil
+	}
+
+	switch hc.Type {
+	case runtime.HealthHTTP:
+		if len(hc.Path) == 0 {
+			hc.Path = "/"
+		}
+	case runtime.HealthTCP:
+	case runtime.HealthExec:
+		if len(hc.Command) == 0 {
+			return fmt.Errorf("Health check command not set")
+		}
+	default:
+		return fmt.Errorf("Health check type must be one of %s, %s or %s",
+			runtime.HealthHTTP, runtime.HealthTCP, runtime.HealthExec)
+	}
+
+	if hc.InitialDelay < 0 || hc.Interval < 0 || hc.Timeout < 0 {
+		return fmt.Errorf("Health check durations cannot be negative")
+	}
+
+	hc.Defaults()
+	return nil
+}
+
+// watchHealth polls the runtime for the health of an app, moving it
+// to Running once healthy and Unhealthy when its checks fail. The
+// status is the one the app is currently in.
+func watchHealth(a *App, status string) {
+	unwatchHealth(a.Id)
+
+	exit := make(chan bool)
+
+	healthMtx.Lock()
+	watchers[a.Id] = exit
+	healthMtx.Unlock()
+
+	interval := 10 * time.Second
+	grace := defaultGrace
+
+	if hc := a.Config.HealthCheck; hc != nil {
+		interval = time.Duration(hc.Interval) * time.Second
+		grace = time.Duration(hc.InitialDelay+hc.Interval*hc.FailureThreshold) * time.Second
+	}
+
+	go func() {
+		started := time.Now()
+		// apps which have been running are unhealthy without a grace period
+		running := status == StatusRunning
+
+		for {
+			select {
+			case <-exit:
+				return
+			case <-time.After(interval):
+			}
+
+			health, err := getRuntime().Health(a.Id)
+			if err != nil {
+				log.Errorf("Error checking health of %s: %v", a.Id, err)
+				continue
+			}
+
+			next := status
+			switch health.Status {
+			case runtime.Healthy:
+				next = StatusRunning
+			case runtime.Unhealthy:
+				// failures while starting are expected until the grace period ends
+				if running || time.Since(started) > grace {
+					next = StatusUnhealthy
+				}
+			}
+
+			if next == status {
+				continue
+			}
+
+			// only advance once the status is recorded so a failed update is retried
+			if err := a.UpdateStatus(&Info{
+				Actor:   "health check",
+				Status:  next,
+				Reason:  "Health check",
+				Message: health.Message,
+			}); err != nil {
+				// the app may have moved on, e.g. while stopping
+				if _, ok := err.(*TransitionError); ok {
+					log.Debugf("Not updating health status of %s: %v", a.Id, err)
+				} else {
+					log.Errorf("Error updating health status of %s: %v", a.Id, err)
+				}
+				continue
+			}
+			status = next
+			if status == StatusRunning {
+				running = true
+			}
+		}
+	}()
+}
+
+// resumeHealth watches the health of apps which are up. Watchers
+// only live as long as the server so they are resumed on startup.
+func resumeHealth() error {
+	apps, err := List(0, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range apps {
+		if a.Config == nil || a.Config.Job != nil {
+			continue
+		}
+		if status, err := Status(a.Id); err == nil && isUp(status.Status) {
+			watchHealth(a, status.Status)
+		}
+	}
+
+	return nil
+}
+
+func unwatchHealth(id string) {
+	healthMtx.Lock()
+	defer healthMtx.Unlock()
+
+	if exit, ok := watchers[id]; ok {
+		close(exit)
+		delete(watchers, id)
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/myodc/playground-server/server/store"
+)
+
+var (
+	historyNamespace = "playground:apps:status:history:"
+
+	// actor of changes made by the server itself
+	actorSystem = "system"
+)
+
+// historyLimit is the number of status changes kept per app, set
+// by PLAYGROUND_STATUS_HISTORY
+func historyLimit() int {
+	if n, err := strconv.Atoi(os.Getenv("PLAYGROUND_STATUS_HISTORY")); err == nil && n > 0 {
+		return n
+	}
+	return 100
+}
+
+// historyAge is how long status changes are kept, set in days by
+// PLAYGROUND_STATUS_HISTORY_DAYS, 0 to keep them up to the limit
+func historyAge() time.Duration {
+	if n, err := strconv.Atoi(os.Getenv("PLAYGROUND_STATUS_HISTORY_DAYS")); err == nil && n >= 0 {
+		return time.Duration(n) * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// As sets who is acting on the app, recorded with its status changes
+func (a *App) As(actor string) *App {
+	a.actor = actor
+	return a
+}
+
+func (a *App) actorOr(actor string) string {
+	if len(a.actor) > 0 {
+		return a.actor
+	}
+	return actor
+}
+
+func historyKey(info *Info) string {
+	return strconv.FormatInt(info.Timestamp.UnixNano(), 36)
+}
+
+// addHistory adds a status change to the timeline of an app in batch
+func addHistory(batch *store.Batch, info *Info, b []byte) {
+	batch.Put(historyNamespace+info.AppId, historyKey(info), b)
+}
+
+// pruneHistory trims the timeline of an app to the retention policy
+func pruneHistory(id string) error {
+	results, err := store.Range(historyNamespace+id, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	limit := historyLimit()
+	age := historyAge()
+
+	var expired [][]byte
+	for i, result := range results {
+		var info *Info
+		if err := json.Unmarshal(result, &info); err != nil {
+			return err
+		}
+		if i >= limit || (age > 0 && time.Since(info.Timestamp) > age) {
+			expired = append(expired, result)
+		}
+	}
+
+	batch := store.NewBatch()
+	if err := deleteHistory(batch, id, expired); err != nil {
+		return err
+	}
+	return batch.Exec()
+}
+
+func deleteHistory(batch *store.Batch, id string, results [][]byte) error {
+	for _, result := range results {
+		var info *Info
+		if err := json.Unmarshal(result, &info); err != nil {
+			return err
+		}
+		batch.Del(historyNamespace+id, historyKey(info))
+	}
+	return nil
+}
+
+// removeHistory adds deleting the timeline of an app to batch
+func removeHistory(batch *store.Batch, id string) {
+	batch.Drop(historyNamespace + id)
+}
+
+// History lists the status changes of an app, newest first
+func History(id string, offset, limit int) ([]*Info, error) {
+	results, err := store.Range(historyNamespace+id, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	var history []*Info
+	for _, result := range results {
+		var info *Info
+		if err := json.Unmarshal(result, &info); err != nil {
+			return nil, err
+		}
+		history = append(history, info)
+	}
+	return history, nil
+}
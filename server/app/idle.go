@@ -0,0 +1,161 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/metrics"
+	"github.com/myodc/playground-server/server/runtime"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	// how long a woken app has to become healthy
+	maxWake = 5 * time.Minute
+
+	wakeMtx sync.Mutex
+	waking  = make(map[string]chan error)
+)
+
+// Sleep stops an idle app so it can be woken on the next request
+func (a *App) Sleep() error {
+	if err := a.Stop(); err != nil {
+		return err
+	}
+
+	return a.UpdateStatus(&Info{
+		Status:  StatusIdle,
+		Reason:  "Idle timeout",
+		Message: fmt.Sprintf("No requests for %d minutes", a.Config.IdleTimeout),
+	})
+}
+
+// Wake starts an idle app and blocks until it is healthy or the
+// timeout expires. Concurrent callers share a single start. Apps
+// which are already up return immediately.
+func Wake(id string, timeout time.Duration) error {
+	// waking counts as traffic
+	if err := metrics.Hit(id); err != nil {
+		log.Errorf("Error recording request for %s: %v", id, err)
+	}
+
+	wakeMtx.Lock()
+	ch, ok := waking[id]
+	if !ok {
+		status, err := Status(id)
+		if err != nil {
+			wakeMtx.Unlock()
+			return err
+		}
+
+		switch {
+		case isUp(status.Status):
+			wakeMtx.Unlock()
+			return nil
+		case status.Status != StatusIdle:
+			wakeMtx.Unlock()
+			return fmt.Errorf("App is %s", status.Status)
+		}
+
+		ch = make(chan error, 1)
+		waking[id] = ch
+		go wake(id, ch)
+	}
+	wakeMtx.Unlock()
+
+	select {
+	case err := <-ch:
+		// pass the result on to the next waiter
+		ch <- err
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("Timed out waking app")
+	}
+}
+
+func wake(id string, ch chan error) {
+	defer func() {
+		wakeMtx.Lock()
+		delete(waking, id)
+		wakeMtx.Unlock()
+	}()
+
+	a, err := Read(id)
+	if err != nil {
+		ch <- err
+		return
+	}
+
+	a.As("wake")
+	a.UpdateStatus(&Info{
+		Status:  StatusWaking,
+		Reason:  "Request received",
+		Message: "Waking idle app",
+	})
+
+	if err := a.Start(); err != nil {
+		ch <- err
+		return
+	}
+
+	// poll the runtime directly rather than wait on the health watcher
+	deadline := time.Now().Add(maxWake)
+	for time.Now().Before(deadline) {
+		health, err := getRuntime().Health(id)
+		if err == nil && health.Status == runtime.Healthy {
+			ch <- nil
+			return
+		}
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	ch <- fmt.Errorf("App did not become healthy within %v", maxWake)
+}
+
+// Reap puts apps to sleep once they are idle for longer
+// than their idle timeout. Blocking.
+func Reap(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		apps, err := List(0, -1)
+		if err != nil {
+			log.Errorf("Error listing apps to reap: %v", err)
+			continue
+		}
+
+		for _, a := range apps {
+			if a.Config == nil || a.Config.IdleTimeout <= 0 {
+				continue
+			}
+			if err := reap(a); err != nil {
+				log.Errorf("Error putting %s to sleep: %v", a.Id, err)
+			}
+		}
+	}
+}
+
+func reap(a *App) error {
+	status, err := Status(a.Id)
+	if err != nil || !isUp(status.Status) {
+		return err
+	}
+
+	last, err := metrics.LastHit(a.Id)
+	if err != nil {
+		return err
+	}
+
+	// apps without traffic are idle from when their status last changed
+	if status.Timestamp.After(last) {
+		last = status.Timestamp
+	}
+
+	if time.Since(last) < time.Duration(a.Config.IdleTimeout)*time.Minute {
+		return nil
+	}
+
+	log.Infof("App %s idle since %v, stopping", a.Id, last)
+	return a.As("idle timeout").Sleep()
+}
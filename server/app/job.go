@@ -0,0 +1,496 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/events"
+	"github.com/myodc/playground-server/server/runtime"
+	"github.com/myodc/playground-server/server/store"
+	"github.com/robfig/cron"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	ConcurrencyAllow   = "Allow"
+	ConcurrencyForbid  = "Forbid"
+	ConcurrencyReplace = "Replace"
+
+	RunRunning   = "Running"
+	RunSucceeded = "Succeeded"
+	RunFailed    = "Failed"
+	RunTimedOut  = "TimedOut"
+	RunKilled    = "Killed"
+)
+
+var (
+	// run history, one namespace per app
+	runNamespace = "playground:apps:runs:"
+	// output kept for each run
+	maxRunLogs = 64 * 1024
+	// runs kept for each job
+	defaultRunHistory = 20
+
+	jobMtx sync.Mutex
+	// active runs by app and run id
+	active = make(map[string]map[string]*activeRun)
+	// when each job was last scheduled
+	scheduled = make(map[string]time.Time)
+)
+
+type activeRun struct {
+	sync.Mutex
+	run *Run
+	// runtime name of the current attempt
+	attempt  string
+	killed   bool
+	timedOut bool
+}
+
+func validateJob(config *Config) error {
+	job := config.Job
+	if job == nil {
+		return nil
+	}
+
+	if len(job.Schedule) > 0 {
+		if _, err := cron.Parse(job.Schedule); err != nil {
+			return fmt.Errorf("Invalid job schedule: %v", err)
+		}
+	}
+
+	switch job.Concurrency {
+	case "":
+		job.Concurrency = ConcurrencyAllow
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return fmt.Errorf("Job concurrency must be one of %s, %s or %s",
+			ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace)
+	}
+
+	if job.Timeout < 0 || job.Retries < 0 {
+		return fmt.Errorf("Job timeout and retries cannot be negative")
+	}
+
+	if config.Autoscale != nil || config.IdleTimeout > 0 {
+		return fmt.Errorf("Jobs cannot be autoscaled or idled")
+	}
+
+	return nil
+}
+
+func runHistory() int {
+	if n, err := strconv.Atoi(os.Getenv("PLAYGROUND_JOB_HISTORY")); err == nil && n > 0 {
+		return n
+	}
+	return defaultRunHistory
+}
+
+// Trigger starts a run of a job app in the background and
+// returns it. The job's concurrency policy decides what happens
+// to runs which are already active.
+func Trigger(id, trigger string) (*Run, error) {
+	a, err := Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Config == nil || a.Config.Job == nil {
+		return nil, fmt.Errorf("App is not a job")
+	}
+
+	if len(a.Image) == 0 {
+		return nil, fmt.Errorf("App image not set")
+	}
+
+	// not while a build is in progress
+	if err := a.Can(StatusRunning); err != nil {
+		return nil, err
+	}
+
+	if trigger == "scheduled" {
+		a.As("scheduler")
+	}
+
+	runner, ok := getRuntime().(runtime.Runner)
+	if !ok {
+		return nil, fmt.Errorf("Runtime cannot run jobs")
+	}
+
+	now := time.Now()
+	run := &Run{
+		Id:      strconv.FormatInt(now.UnixNano(), 36),
+		AppId:   id,
+		Status:  RunRunning,
+		Trigger: trigger,
+		Started: now,
+	}
+
+	jobMtx.Lock()
+	runs := active[id]
+	if len(runs) > 0 && a.Config.Job.Concurrency == ConcurrencyForbid {
+		jobMtx.Unlock()
+		return nil, fmt.Errorf("Job is already running")
+	}
+
+	var replaced []*activeRun
+	if a.Config.Job.Concurrency == ConcurrencyReplace {
+		for _, ar := range runs {
+			replaced = append(replaced, ar)
+		}
+	}
+
+	if runs == nil {
+		runs = make(map[string]*activeRun)
+		active[id] = runs
+	}
+	ar := &activeRun{run: run}
+	runs[run.Id] = ar
+	jobMtx.Unlock()
+
+	for _, r := range replaced {
+		if err := r.kill(runner); err != nil {
+			log.Errorf("Error replacing run %s of %s: %v", r.run.Id, id, err)
+		}
+	}
+
+	if err := saveRun(run); err != nil {
+		jobMtx.Lock()
+		delete(runs, run.Id)
+		jobMtx.Unlock()
+		return nil, err
+	}
+
+	// the run is updated as it executes
+	started := *run
+
+	go execute(a, runner, ar)
+
+	return &started, nil
+}
+
+// execute makes attempts at a run until one succeeds, the retries
+// are used up or the run is killed
+func execute(a *App, runner runtime.Runner, ar *activeRun) {
+	run := ar.run
+	job := a.Config.Job
+
+	defer func() {
+		jobMtx.Lock()
+		delete(active[a.Id], run.Id)
+		if len(active[a.Id]) == 0 {
+			delete(active, a.Id)
+		}
+		jobMtx.Unlock()
+	}()
+
+	a.UpdateStatus(&Info{
+		Status:  StatusRunning,
+		Reason:  "Job " + run.Trigger,
+		Message: fmt.Sprintf("Job run %s started", run.Id),
+	})
+
+	// make the output available for streaming
+	in, out := io.Pipe()
+	go events.ReceiveLogs(a.Id, in)
+	defer out.Close()
+
+	logs := &tailBuffer{max: maxRunLogs}
+	timeout := time.Duration(job.Timeout) * time.Second
+
+	for attempt := 1; attempt <= job.Retries+1; attempt++ {
+		ar.Lock()
+		if ar.killed {
+			ar.Unlock()
+			break
+		}
+		name := fmt.Sprintf("%s-%d", run.Id, attempt)
+		ar.attempt = name
+		ar.Unlock()
+
+		run.Attempts = attempt
+		logs.Reset()
+
+		var timer *time.Timer
+		if timeout > 0 {
+			timer = time.AfterFunc(timeout, func() {
+				ar.Lock()
+				ar.timedOut = true
+				ar.Unlock()
+				if err := runner.Kill(a.Id, name); err != nil {
+					log.Errorf("Error killing run %s of %s: %v", name, a.Id, err)
+				}
+			})
+		}
+
+		code, err := runner.Run(a.Id, name, &runtime.Job{
+			Image:     a.Image,
+			Volumes:   a.Config.Volumes,
+			Resources: a.Config.Resources,
+			Env:       a.env(),
+			Labels: map[string]string{
+				"name": a.Id,
+				"run":  run.Id,
+			},
+		}, io.MultiWriter(logs, out))
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		ar.Lock()
+		killed, timedOut := ar.killed, ar.timedOut
+		ar.timedOut = false
+		ar.Unlock()
+
+		run.ExitCode = code
+		run.Error = ""
+
+		switch {
+		case killed:
+			run.Status = RunKilled
+		case timedOut:
+			run.Status = RunTimedOut
+			run.Error = fmt.Sprintf("Timed out after %v", timeout)
+		case err != nil:
+			run.Status = RunFailed
+			run.Error = err.Error()
+		case code != 0:
+			run.Status = RunFailed
+		default:
+			run.Status = RunSucceeded
+		}
+
+		if run.Status == RunSucceeded || run.Status == RunKilled {
+			break
+		}
+
+		log.Infof("Run %s of %s attempt %d: %s %s", run.Id, a.Id, attempt, run.Status, run.Error)
+	}
+
+	// killed before the first attempt
+	if run.Status == RunRunning {
+		run.Status = RunKilled
+	}
+
+	run.Logs = logs.String()
+	run.Finished = time.Now()
+
+	if err := saveRun(run); err != nil {
+		log.Errorf("Error saving run %s of %s: %v", run.Id, a.Id, err)
+	}
+
+	if err := pruneRuns(a.Id); err != nil {
+		log.Errorf("Error pruning runs of %s: %v", a.Id, err)
+	}
+
+	a.UpdateStatus(&Info{
+		Status:  run.Status,
+		Reason:  "Job " + run.Trigger,
+		Message: fmt.Sprintf("Job run %s finished with exit code %d", run.Id, run.ExitCode),
+	})
+}
+
+func (ar *activeRun) kill(runner runtime.Runner) error {
+	ar.Lock()
+	ar.killed = true
+	attempt := ar.attempt
+	ar.Unlock()
+
+	if len(attempt) == 0 {
+		return nil
+	}
+
+	return runner.Kill(ar.run.AppId, attempt)
+}
+
+// Kill stops an active run of a job
+func Kill(id, runId string) error {
+	runner, ok := getRuntime().(runtime.Runner)
+	if !ok {
+		return fmt.Errorf("Runtime cannot run jobs")
+	}
+
+	jobMtx.Lock()
+	ar, ok := active[id][runId]
+	jobMtx.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Run is not active")
+	}
+
+	return ar.kill(runner)
+}
+
+func saveRun(run *Run) error {
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return store.Put(runNamespace+run.AppId, run.Id, b)
+}
+
+// pruneRuns removes runs older than the history kept
+func pruneRuns(id string) error {
+	results, err := store.Range(runNamespace+id, runHistory(), -1)
+	if err != nil {
+		return err
+	}
+	return deleteRuns(id, results)
+}
+
+func deleteRuns(id string, results [][]byte) error {
+	batch := store.NewBatch()
+	for _, result := range results {
+		var run *Run
+		if err := json.Unmarshal(result, &run); err != nil {
+			return err
+		}
+		batch.Del(runNamespace+id, run.Id)
+	}
+	return batch.Exec()
+}
+
+// removeJob kills the active runs of an app and removes its history
+func removeJob(id string) error {
+	jobMtx.Lock()
+	var runs []*activeRun
+	for _, ar := range active[id] {
+		runs = append(runs, ar)
+	}
+	delete(scheduled, id)
+	jobMtx.Unlock()
+
+	if runner, ok := getRuntime().(runtime.Runner); ok {
+		for _, ar := range runs {
+			if err := ar.kill(runner); err != nil {
+				log.Errorf("Error killing run %s of %s: %v", ar.run.Id, id, err)
+			}
+		}
+	}
+
+	results, err := store.Range(runNamespace+id, 0, -1)
+	if err != nil {
+		return err
+	}
+	return deleteRuns(id, results)
+}
+
+// Runs lists the runs of a job, newest first
+func Runs(id string, offset, limit int) ([]*Run, error) {
+	results, err := store.Range(runNamespace+id, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Run
+	for _, result := range results {
+		var run *Run
+		if err := json.Unmarshal(result, &run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func ReadRun(id, runId string) (*Run, error) {
+	b, err := store.Get(runNamespace+id, runId)
+	if err != nil {
+		return nil, err
+	}
+	var run *Run
+	if err := json.Unmarshal(b, &run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Schedule triggers jobs whose cron schedule is due. Jobs are
+// scheduled from when they are first seen, so runs missed while
+// the server is down are skipped. Blocking.
+func Schedule(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		apps, err := List(0, -1)
+		if err != nil {
+			log.Errorf("Error listing apps to schedule: %v", err)
+			continue
+		}
+
+		now := time.Now()
+		for _, a := range apps {
+			if a.Config == nil || a.Config.Job == nil || len(a.Config.Job.Schedule) == 0 {
+				continue
+			}
+			if err := schedule(a, now); err != nil {
+				log.Errorf("Error scheduling %s: %v", a.Id, err)
+			}
+		}
+	}
+}
+
+func schedule(a *App, now time.Time) error {
+	sched, err := cron.Parse(a.Config.Job.Schedule)
+	if err != nil {
+		return err
+	}
+
+	jobMtx.Lock()
+	last, ok := scheduled[a.Id]
+	if !ok {
+		scheduled[a.Id] = now
+		jobMtx.Unlock()
+		return nil
+	}
+
+	if sched.Next(last).After(now) {
+		jobMtx.Unlock()
+		return nil
+	}
+	scheduled[a.Id] = now
+	jobMtx.Unlock()
+
+	run, err := Trigger(a.Id, "scheduled")
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Scheduled run %s of %s", run.Id, a.Id)
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written
+type tailBuffer struct {
+	sync.Mutex
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.buf = append(t.buf, b...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.buf = t.buf[over:]
+	}
+	return len(b), nil
+}
+
+func (t *tailBuffer) Reset() {
+	t.Lock()
+	t.buf = nil
+	t.Unlock()
+}
+
+func (t *tailBuffer) String() string {
+	t.Lock()
+	defer t.Unlock()
+	return string(t.buf)
+}
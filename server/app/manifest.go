@@ -0,0 +1,240 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+	"github.com/myodc/playground-server/server/store"
+)
+
+const (
+	ManifestKind    = "App"
+	ManifestVersion = "v1"
+
+	ApplyCreated   = "Created"
+	ApplyUpdated   = "Updated"
+	ApplyUnchanged = "Unchanged"
+)
+
+// Manifest is the declarative spec of an app. Built images and
+// timestamps are left out so a manifest can be applied anywhere.
+type Manifest struct {
+	Kind        string
+	Version     string
+	Id          string
+	Namespace   string
+	Description string
+	Source      *Source
+	Config      *Config
+}
+
+// Change is a field which differs between an app and a manifest
+type Change struct {
+	Path string
+	Old  interface{} `json:",omitempty"`
+	New  interface{} `json:",omitempty"`
+}
+
+// Applied is the outcome of applying a manifest
+type Applied struct {
+	Action  string
+	DryRun  bool
+	Changes []*Change
+	App     *App
+}
+
+// ParseManifest reads a manifest in YAML or JSON
+func ParseManifest(b []byte) (*Manifest, error) {
+	var m *Manifest
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("Manifest is empty")
+	}
+
+	if len(m.Kind) > 0 && m.Kind != ManifestKind {
+		return nil, fmt.Errorf("Manifest kind must be %s", ManifestKind)
+	}
+
+	if len(m.Version) > 0 && m.Version != ManifestVersion {
+		return nil, fmt.Errorf("Manifest version %s not supported", m.Version)
+	}
+
+	return m, nil
+}
+
+// MarshalManifest renders a manifest as yaml or json
+func MarshalManifest(m *Manifest, format string) ([]byte, error) {
+	switch format {
+	case "", "yaml":
+		return yaml.Marshal(m)
+	case "json":
+		return json.MarshalIndent(m, "", "  ")
+	}
+	return nil, fmt.Errorf("Unknown manifest format %s", format)
+}
+
+func manifestFor(a *App) *Manifest {
+	return &Manifest{
+		Kind:        ManifestKind,
+		Version:     ManifestVersion,
+		Id:          a.Id,
+		Namespace:   a.Namespace,
+		Description: a.Description,
+		Source:      a.Source,
+		Config:      a.Config,
+	}
+}
+
+func (m *Manifest) app() *App {
+	return &App{
+		Id:          m.Id,
+		Namespace:   m.Namespace,
+		Description: m.Description,
+		Source:      m.Source,
+		Config:      m.Config,
+	}
+}
+
+// Export returns the manifest of an existing app
+func Export(id string) (*Manifest, error) {
+	a, err := Read(id)
+	if err != nil {
+		return nil, err
+	}
+	return manifestFor(a), nil
+}
+
+// Apply creates the app in a manifest or updates it to match.
+// Applying the same manifest again changes nothing. With dryRun
+// set the changes are only reported.
+func Apply(m *Manifest, dryRun bool) (*Applied, error) {
+	a := m.app()
+	if err := validate(a); err != nil {
+		return nil, &ValidationError{err}
+	}
+
+	existing, err := Read(a.Id)
+	if err == store.ErrNotFound {
+		applied := &Applied{
+			Action:  ApplyCreated,
+			DryRun:  dryRun,
+			Changes: diff(nil, manifestFor(a)),
+			App:     a,
+		}
+		if dryRun {
+			return applied, nil
+		}
+		return applied, Create(a)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// compare against the existing app with current defaults,
+	// errors are from rules added since it was stored
+	validate(existing)
+
+	applied := &Applied{
+		DryRun:  dryRun,
+		Changes: diff(manifestFor(existing), manifestFor(a)),
+		App:     existing,
+	}
+
+	if len(applied.Changes) == 0 {
+		applied.Action = ApplyUnchanged
+		return applied, nil
+	}
+
+	applied.Action = ApplyUpdated
+	if dryRun {
+		return applied, nil
+	}
+
+	// keep the build of the existing app, which must not
+	// have changed since it was compared
+	a.Image = existing.Image
+	a.Revision = existing.Revision
+	applied.App = a
+
+	return applied, Update(a)
+}
+
+// diff lists the fields which differ between two manifests
+func diff(old, updated *Manifest) []*Change {
+	o := flatten(old)
+	n := flatten(updated)
+
+	var changes []*Change
+	for path, nv := range n {
+		if ov, ok := o[path]; !ok || ov != nv {
+			changes = append(changes, &Change{Path: path, Old: o[path], New: nv})
+		}
+	}
+	for path, ov := range o {
+		if _, ok := n[path]; !ok {
+			changes = append(changes, &Change{Path: path, Old: ov})
+		}
+	}
+
+	sort.Sort(byPath(changes))
+	return changes
+}
+
+// flatten maps the dotted path of each field to its value
+func flatten(m *Manifest) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if m == nil {
+		return fields
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fields
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fields
+	}
+
+	flattenValue("", v, fields)
+	return fields
+}
+
+func flattenValue(path string, v interface{}, fields map[string]interface{}) {
+	join := func(key string) string {
+		if len(path) == 0 {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			flattenValue(join(k), child, fields)
+		}
+	case []interface{}:
+		for i, child := range t {
+			flattenValue(join(strconv.Itoa(i)), child, fields)
+		}
+	case nil:
+	default:
+		// zero values are the same as unset
+		if t == "" || t == false || t == float64(0) {
+			return
+		}
+		fields[path] = t
+	}
+}
+
+type byPath []*Change
+
+func (b byPath) Len() int           { return len(b) }
+func (b byPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byPath) Less(i, j int) bool { return b[i].Path < b[j].Path }
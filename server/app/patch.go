@@ -0,0 +1,43 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Patch changes only the fields of an app in a partial app JSON.
+// Objects are merged into the app's, lists and values replace its
+// own and null clears a field. With revision set the app must
+// still be at that revision.
+func Patch(id string, patch []byte, revision int64) (*App, error) {
+	a, err := Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if revision > 0 && revision != a.Revision {
+		return nil, ErrStaleRevision
+	}
+
+	// the id and build of the app are not patched
+	image := a.Image
+	current := a.Revision
+
+	if err := json.Unmarshal(patch, &a); err != nil {
+		return nil, &ValidationError{fmt.Errorf("Invalid patch: %v", err)}
+	}
+
+	if a == nil {
+		return nil, &ValidationError{fmt.Errorf("Invalid patch: null")}
+	}
+
+	a.Id = id
+	a.Image = image
+	a.Revision = current
+
+	if err := Update(a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
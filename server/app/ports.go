@@ -0,0 +1,89 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+var (
+	portNameRe = regexp.MustCompile("^[a-z]([a-z0-9-]*[a-z0-9])?$")
+)
+
+// validatePorts checks the ports of an app and picks the primary
+// port. Apps without ports get a single public http port.
+func validatePorts(config *Config) error {
+	if len(config.Ports) == 0 {
+		if config.ContainerPort == 0 {
+			config.ContainerPort = 8080
+		}
+		config.Ports = []runtime.Port{{
+			Name:          "http",
+			ContainerPort: config.ContainerPort,
+			Protocol:      runtime.ProtocolHTTP,
+			Public:        true,
+		}}
+		return nil
+	}
+
+	names := make(map[string]bool)
+	numbers := make(map[string]bool)
+
+	for i := range config.Ports {
+		port := &config.Ports[i]
+
+		if !portNameRe.MatchString(port.Name) || len(port.Name) > 15 {
+			return fmt.Errorf("Port name %q invalid. Must match %s", port.Name, portNameRe.String())
+		}
+		if names[port.Name] {
+			return fmt.Errorf("Port name %s used more than once", port.Name)
+		}
+		names[port.Name] = true
+
+		if port.ContainerPort < 1 || port.ContainerPort > 65535 {
+			return fmt.Errorf("Port %s must be between 1 and 65535", port.Name)
+		}
+
+		port.Protocol = strings.ToUpper(port.Protocol)
+		switch port.Protocol {
+		case "":
+			port.Protocol = runtime.ProtocolTCP
+		case runtime.ProtocolTCP, runtime.ProtocolUDP, runtime.ProtocolHTTP, runtime.ProtocolGRPC:
+		default:
+			return fmt.Errorf("Port %s protocol must be one of TCP, UDP, HTTP or GRPC", port.Name)
+		}
+
+		key := fmt.Sprintf("%d/%s", port.ContainerPort, port.Transport())
+		if numbers[key] {
+			return fmt.Errorf("Port %s used more than once", key)
+		}
+		numbers[key] = true
+	}
+
+	// keep the primary port if it is one of the ports
+	for _, port := range config.Ports {
+		if port.ContainerPort == config.ContainerPort {
+			return nil
+		}
+	}
+
+	config.ContainerPort = primaryPort(config.Ports).ContainerPort
+	return nil
+}
+
+// primaryPort prefers public http ports then any public port
+func primaryPort(ports []runtime.Port) *runtime.Port {
+	for i, port := range ports {
+		if port.Public && port.Protocol == runtime.ProtocolHTTP {
+			return &ports[i]
+		}
+	}
+	for i, port := range ports {
+		if port.Public {
+			return &ports[i]
+		}
+	}
+	return &ports[0]
+}
@@ -0,0 +1,366 @@
+package app
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/myodc/playground-server/server/metrics"
+	"github.com/myodc/playground-server/server/store"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	previewNamespace = "playground:previews"
+	// derived ids are kept short enough for runtime resource names
+	maxPreviewId = 40
+	slugRe       = regexp.MustCompile("[^a-z0-9]+")
+)
+
+func validatePreviews(app *App) error {
+	p := app.Config.Previews
+	if p == nil {
+		return nil
+	}
+
+	if app.Source.GitRepo == nil {
+		return fmt.Errorf("Previews require a git repo source")
+	}
+
+	if app.Config.Job != nil {
+		return fmt.Errorf("Previews are not supported for jobs")
+	}
+
+	if p.TTL < 0 {
+		return fmt.Errorf("Preview TTL cannot be negative")
+	}
+
+	return nil
+}
+
+// previewId derives the id of a preview from its app and branch.
+// Long ids, or ids already taken by another branch, are shortened
+// and made unique with a hash of the branch.
+func previewId(parent, branch string, hashed bool) string {
+	slug := strings.Trim(slugRe.ReplaceAllString(strings.ToLower(branch), "-"), "-")
+	id := parent + "-" + slug
+	if len(id) <= maxPreviewId && !hashed {
+		return id
+	}
+
+	sum := sha1.Sum([]byte(branch))
+	suffix := hex.EncodeToString(sum[:])[:7]
+	if len(id) > maxPreviewId-8 {
+		id = id[:maxPreviewId-8]
+	}
+	return strings.TrimRight(id, "-") + "-" + suffix
+}
+
+func ownBranch(a *App) string {
+	if len(a.Source.GitRepo.Branch) == 0 {
+		return "master"
+	}
+	return a.Source.GitRepo.Branch
+}
+
+func readPreview(id string) (*Preview, error) {
+	b, err := store.Get(previewNamespace, id)
+	if err != nil {
+		return nil, err
+	}
+	var p *Preview
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func savePreview(p *Preview) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return store.Put(previewNamespace, p.AppId, b)
+}
+
+// Previews lists the branch previews of an app
+func Previews(parent string) ([]*Preview, error) {
+	results, err := store.Range(previewNamespace, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var previews []*Preview
+	for _, result := range results {
+		var p *Preview
+		if err := json.Unmarshal(result, &p); err != nil {
+			return nil, err
+		}
+		if p.Parent == parent {
+			previews = append(previews, p)
+		}
+	}
+	return previews, nil
+}
+
+// claimPreviewId checks an id can be used for the preview of a
+// branch. It returns the existing preview, nil if the id is free,
+// or false if the id belongs to another app or preview.
+func claimPreviewId(id, parent, branch string) (*Preview, bool, error) {
+	p, err := readPreview(id)
+	switch {
+	case err == nil:
+		return p, p.Parent == parent && p.Branch == branch, nil
+	case err != store.ErrNotFound:
+		return nil, false, err
+	}
+
+	// an app which is not a preview
+	_, err = Read(id)
+	switch {
+	case err == nil:
+		return nil, false, nil
+	case err != store.ErrNotFound:
+		return nil, false, err
+	}
+
+	return nil, true, nil
+}
+
+// PreviewBranch creates or updates the preview of an app for a
+// branch. The preview app is returned to be built and deployed.
+func PreviewBranch(parent, branch, commit string) (*App, *Preview, error) {
+	a, err := Read(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if a.Config.Previews == nil {
+		return nil, nil, fmt.Errorf("Previews not enabled for %s", parent)
+	}
+
+	if err := ValidBranch(branch); err != nil {
+		return nil, nil, err
+	}
+
+	if branch == ownBranch(a) {
+		return nil, nil, fmt.Errorf("Branch %s is deployed by %s itself", branch, parent)
+	}
+
+	id := previewId(parent, branch, false)
+	p, ok, err := claimPreviewId(id, parent, branch)
+	if err == nil && !ok {
+		id = previewId(parent, branch, true)
+		p, ok, err = claimPreviewId(id, parent, branch)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !ok {
+		return nil, nil, fmt.Errorf("Preview id %s is taken by another app", id)
+	}
+
+	if p == nil {
+		p = &Preview{
+			AppId:   id,
+			Parent:  parent,
+			Branch:  branch,
+			Created: time.Now(),
+		}
+	}
+
+	p.Commit = commit
+	p.Updated = time.Now()
+
+	// the preview follows the app's current config
+	repo := *a.Source.GitRepo
+	repo.Branch = branch
+
+	config := *a.Config
+	config.Previews = nil
+	config.Services = nil
+
+	preview, err := Read(id)
+	switch {
+	case err == store.ErrNotFound:
+		preview = &App{
+			Id:          id,
+			Namespace:   a.Namespace,
+			Description: fmt.Sprintf("Preview of %s for branch %s", parent, branch),
+			Source:      &Source{GitRepo: &repo},
+			Config:      &config,
+		}
+		if err := Create(preview); err != nil {
+			return nil, nil, err
+		}
+	case err != nil:
+		return nil, nil, err
+	default:
+		config.Services = preview.Config.Services
+		preview.Source = &Source{GitRepo: &repo}
+		preview.Config = &config
+		if err := Update(preview); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := savePreview(p); err != nil {
+		return nil, nil, err
+	}
+
+	// share the app's backing services
+	for _, svc := range a.Config.Services {
+		if err := Bind(svc, id); err != nil {
+			log.Errorf("Error binding %s to preview %s: %v", svc, id, err)
+		}
+	}
+
+	// Bind updated the stored app
+	preview, err = Read(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return preview, p, nil
+}
+
+// DeletePreview removes the preview of an app for a branch
+func DeletePreview(parent, branch string) error {
+	previews, err := Previews(parent)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range previews {
+		if p.Branch == branch {
+			return Delete(p.AppId, true)
+		}
+	}
+
+	return fmt.Errorf("No preview of %s for branch %s", parent, branch)
+}
+
+// removePreviews deletes the previews of a deleted app, or the
+// record of a deleted preview
+func removePreviews(id string) error {
+	previews, err := Previews(id)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range previews {
+		if err := Delete(p.AppId, true); err != nil {
+			return err
+		}
+	}
+
+	return store.Del(previewNamespace, id)
+}
+
+// Push handles a push to a git repo, creating or updating the
+// previews of the apps built from it which have previews enabled.
+// A deleted branch removes its previews. The previews to build
+// are returned.
+func Push(url, branch, commit string, deleted bool) ([]*App, error) {
+	apps, err := List(0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var previews []*App
+	for _, a := range apps {
+		if a.Config == nil || a.Config.Previews == nil || a.Source == nil || a.Source.GitRepo == nil {
+			continue
+		}
+
+		if repoKey(a.Source.GitRepo.Url) != repoKey(url) || branch == ownBranch(a) {
+			continue
+		}
+
+		if deleted {
+			if err := DeletePreview(a.Id, branch); err != nil {
+				log.Debugf("Not removing preview of %s: %v", a.Id, err)
+			}
+			continue
+		}
+
+		preview, _, err := PreviewBranch(a.Id, branch, commit)
+		if err != nil {
+			log.Errorf("Error creating preview of %s for %s: %v", a.Id, branch, err)
+			continue
+		}
+		previews = append(previews, preview)
+	}
+
+	return previews, nil
+}
+
+// repoKey normalises a repo url so clone and web urls match
+func repoKey(url string) string {
+	url = strings.ToLower(strings.TrimSpace(url))
+	for _, prefix := range []string{"https://", "http://", "git://", "ssh://", "git@"} {
+		url = strings.TrimPrefix(url, prefix)
+	}
+	url = strings.Replace(url, ":", "/", 1)
+	url = strings.TrimSuffix(url, "/")
+	return strings.TrimSuffix(url, ".git")
+}
+
+// ExpirePreviews removes previews without requests or pushes for
+// longer than the TTL of their app. Blocking.
+func ExpirePreviews(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		results, err := store.Range(previewNamespace, 0, -1)
+		if err != nil {
+			log.Errorf("Error listing previews to expire: %v", err)
+			continue
+		}
+
+		for _, result := range results {
+			var p *Preview
+			if err := json.Unmarshal(result, &p); err != nil {
+				continue
+			}
+			if err := expire(p); err != nil {
+				log.Errorf("Error expiring preview %s: %v", p.AppId, err)
+			}
+		}
+	}
+}
+
+func expire(p *Preview) error {
+	a, err := Read(p.Parent)
+	if err == store.ErrNotFound {
+		return Delete(p.AppId, true)
+	} else if err != nil {
+		return err
+	}
+
+	if a.Config.Previews == nil || a.Config.Previews.TTL <= 0 {
+		return nil
+	}
+
+	last, err := metrics.LastHit(p.AppId)
+	if err != nil {
+		return err
+	}
+
+	if p.Updated.After(last) {
+		last = p.Updated
+	}
+
+	if time.Since(last) < time.Duration(a.Config.Previews.TTL)*time.Hour {
+		return nil
+	}
+
+	log.Infof("Preview %s unused since %v, removing", p.AppId, last)
+	return Delete(p.AppId, true)
+}
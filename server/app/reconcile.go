@@ -0,0 +1,63 @@
+package app
+
+import (
+	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
+	log "github.com/cihub/seelog"
+)
+
+// Reconcile watches the runtime and updates the status of apps
+// to match what is actually running. Blocking.
+func Reconcile() {
+	watcher, ok := getRuntime().(runtime.Watcher)
+	if !ok {
+		log.Info("Runtime does not support watching, status will not be reconciled")
+		return
+	}
+
+	ch := make(chan *runtime.StateChange, 10)
+	go func() {
+		for change := range ch {
+			reconcile(change)
+		}
+	}()
+
+	for {
+		exit := make(chan bool)
+		if err := watcher.Watch(ch, exit); err != nil {
+			log.Errorf("Error watching runtime: %v", err)
+		}
+		close(exit)
+		time.Sleep(time.Second * 5)
+	}
+}
+
+func reconcile(change *runtime.StateChange) {
+	current, err := Status(change.Name)
+	if err != nil {
+		// not an app we know about
+		return
+	}
+
+	switch current.Status {
+	case change.State:
+		return
+	case StatusStopping, StatusStopped, StatusDeleting:
+		// the app is meant to be down
+		return
+	}
+
+	// a stopped runtime is only news for apps meant to be up
+	if change.State == runtime.StateStopped && current.Status != StatusRunning && current.Status != StatusUnhealthy {
+		return
+	}
+
+	a := &App{Id: change.Name}
+	a.UpdateStatus(&Info{
+		Actor:   "runtime",
+		Status:  change.State,
+		Reason:  change.Reason,
+		Message: change.Message,
+	})
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+var (
+	defaultMaxCPU    = "2"
+	defaultMaxMemory = "2Gi"
+)
+
+// maxResources returns the most an app may request or be limited
+// to, set by PLAYGROUND_MAX_CPU and PLAYGROUND_MAX_MEMORY
+func maxResources() (int64, int64, error) {
+	cpu := os.Getenv("PLAYGROUND_MAX_CPU")
+	if len(cpu) == 0 {
+		cpu = defaultMaxCPU
+	}
+
+	mem := os.Getenv("PLAYGROUND_MAX_MEMORY")
+	if len(mem) == 0 {
+		mem = defaultMaxMemory
+	}
+
+	maxCPU, err := runtime.ParseCPU(cpu)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	maxMem, err := runtime.ParseMemory(mem)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return maxCPU, maxMem, nil
+}
+
+// validateResources checks requests are within limits and limits
+// within the server maximums. Limits which aren't set default to
+// the maximums so every app is bounded.
+func validateResources(config *Config) error {
+	maxCPU, maxMem, err := maxResources()
+	if err != nil {
+		return fmt.Errorf("Invalid server resource maximum: %v", err)
+	}
+
+	if config.Resources == nil {
+		config.Resources = &runtime.Resources{}
+	}
+	r := config.Resources
+
+	reqCPU, err := runtime.ParseCPU(r.Requests.CPU)
+	if err != nil {
+		return err
+	}
+
+	reqMem, err := runtime.ParseMemory(r.Requests.Memory)
+	if err != nil {
+		return err
+	}
+
+	limCPU, err := runtime.ParseCPU(r.Limits.CPU)
+	if err != nil {
+		return err
+	}
+
+	limMem, err := runtime.ParseMemory(r.Limits.Memory)
+	if err != nil {
+		return err
+	}
+
+	if limCPU == 0 {
+		limCPU = maxCPU
+		r.Limits.CPU = runtime.FormatCPU(maxCPU)
+	}
+
+	if limMem == 0 {
+		limMem = maxMem
+		r.Limits.Memory = runtime.FormatMemory(maxMem)
+	}
+
+	if limCPU > maxCPU {
+		return fmt.Errorf("CPU limit cannot exceed %s", runtime.FormatCPU(maxCPU))
+	}
+
+	if limMem > maxMem {
+		return fmt.Errorf("Memory limit cannot exceed %s", runtime.FormatMemory(maxMem))
+	}
+
+	if reqCPU > limCPU {
+		return fmt.Errorf("CPU request cannot exceed the CPU limit")
+	}
+
+	if reqMem > limMem {
+		return fmt.Errorf("Memory request cannot exceed the memory limit")
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/myodc/playground-server/server/docker"
+	"github.com/myodc/playground-server/server/kube"
+	"github.com/myodc/playground-server/server/kubernetes"
+	"github.com/myodc/playground-server/server/runtime"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	rt runtime.Runtime
+)
+
+// Init sets up the runtime set by PLAYGROUND_RUNTIME, the legacy
+// kubernetes api by default, kube for current clusters or docker.
+// It must be called before apps are deployed.
+func Init() error {
+	switch os.Getenv("PLAYGROUND_RUNTIME") {
+	case "docker":
+		rt = docker.NewRuntime()
+	case "kube":
+		client, err := kube.NewClient()
+		if err != nil {
+			return fmt.Errorf("Error creating kubernetes client: %v", err)
+		}
+		rt = kube.NewRuntime(client, namespaceOf)
+	default:
+		rt = kubernetes.NewRuntime(namespaceOf)
+	}
+
+	// health watchers don't survive a restart of the server
+	if err := resumeHealth(); err != nil {
+		log.Errorf("Error resuming health checks: %v", err)
+	}
+
+	return nil
+}
+
+func getRuntime() runtime.Runtime {
+	return rt
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/events"
+	"github.com/myodc/playground-server/server/metrics"
+	"github.com/myodc/playground-server/server/runtime"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	// ratio of current to target within which no scaling happens
+	scaleTolerance = 0.1
+	// minimum time between scaling down an app
+	scaleDownDelay = 3 * time.Minute
+	// window request rate is averaged over
+	rateWindow = 2 * time.Minute
+
+	scaleMtx   sync.Mutex
+	lastScaled = make(map[string]time.Time)
+)
+
+func validateAutoscale(config *Config) error {
+	as := config.Autoscale
+	if as == nil {
+		if config.NumInstances < 0 {
+			return fmt.Errorf("Number of instances cannot be negative")
+		}
+		return nil
+	}
+
+	if as.MinInstances < 1 {
+		as.MinInstances = 1
+	}
+
+	if as.MaxInstances < as.MinInstances {
+		return fmt.Errorf("Autoscale max instances must be at least min instances")
+	}
+
+	if as.TargetCPU <= 0 && as.TargetRequestRate <= 0 {
+		return fmt.Errorf("Autoscale requires a CPU or request rate target")
+	}
+
+	if config.NumInstances < as.MinInstances {
+		config.NumInstances = as.MinInstances
+	}
+	if config.NumInstances > as.MaxInstances {
+		config.NumInstances = as.MaxInstances
+	}
+
+	return nil
+}
+
+// Scale changes the number of instances of an app without a rebuild
+func Scale(id string, replicas int, reason string) error {
+	a, err := Read(id)
+	if err != nil {
+		return err
+	}
+
+	if replicas < 0 {
+		return &ValidationError{fmt.Errorf("Number of instances cannot be negative")}
+	}
+
+	if as := a.Config.Autoscale; as != nil && (replicas < as.MinInstances || replicas > as.MaxInstances) {
+		return &ValidationError{fmt.Errorf("Instances must be between %d and %d while autoscaling", as.MinInstances, as.MaxInstances)}
+	}
+
+	previous := a.Config.NumInstances
+	if previous == replicas {
+		return nil
+	}
+
+	a.Config.NumInstances = replicas
+	if err := Update(a); err != nil {
+		return err
+	}
+
+	// scale running apps, others start with the new count
+	if status, err := Status(id); err == nil && isUp(status.Status) {
+		if err := scaleRuntime(a, replicas); err != nil {
+			return err
+		}
+	}
+
+	scaleMtx.Lock()
+	lastScaled[id] = time.Now()
+	scaleMtx.Unlock()
+
+	events.Send(id, events.Event{
+		Body: fmt.Sprintf("Scaled from %d to %d instances: %s", previous, replicas, reason),
+		Type: events.Scale,
+	})
+
+	return nil
+}
+
+// scaleRuntime scales the instances of an app, creating them from
+// its stored config when it was scaled to zero
+func scaleRuntime(a *App, replicas int) error {
+	err := getRuntime().Scale(a.Id, replicas)
+	if err != runtime.ErrNoInstances {
+		return err
+	}
+
+	service, err := getRuntime().Create(a.Id, a.containerConfig())
+	if err != nil {
+		return err
+	}
+
+	return saveEndpoint(a.Id, service)
+}
+
+// isUp returns true for the statuses of deployed apps, including
+// those failing in the runtime which still have instances
+func isUp(status string) bool {
+	return contains(deployed, status)
+}
+
+// Autoscale enforces the autoscale policy of running apps. Blocking.
+func Autoscale(interval time.Duration) {
+	// runtimes with their own autoscaler are set up on start
+	if _, ok := getRuntime().(runtime.Autoscaler); ok {
+		return
+	}
+
+	for {
+		time.Sleep(interval)
+
+		apps, err := List(0, -1)
+		if err != nil {
+			log.Errorf("Error listing apps to autoscale: %v", err)
+			continue
+		}
+
+		for _, a := range apps {
+			if a.Config == nil || a.Config.Autoscale == nil {
+				continue
+			}
+			if err := autoscale(a); err != nil {
+				log.Errorf("Error autoscaling %s: %v", a.Id, err)
+			}
+		}
+	}
+}
+
+func autoscale(a *App) error {
+	status, err := Status(a.Id)
+	if err != nil || !isUp(status.Status) {
+		return err
+	}
+
+	as := a.Config.Autoscale
+	current := a.Config.NumInstances
+	if current < 1 {
+		current = 1
+	}
+
+	desired := 0
+
+	if as.TargetCPU > 0 {
+		if m, ok := getRuntime().(runtime.Metrics); ok {
+			usage, err := m.Usage(a.Id)
+			if err != nil {
+				return err
+			}
+			if n := replicasFor(current, usage.CPU, float64(as.TargetCPU)); n > desired {
+				desired = n
+			}
+		}
+	}
+
+	if as.TargetRequestRate > 0 {
+		rate, err := metrics.Rate(a.Id, rateWindow)
+		if err != nil {
+			return err
+		}
+		// rate is for the whole app so target it per instance
+		if n := replicasFor(current, rate/float64(current), as.TargetRequestRate); n > desired {
+			desired = n
+		}
+	}
+
+	if desired == 0 {
+		return nil
+	}
+	if desired < as.MinInstances {
+		desired = as.MinInstances
+	}
+	if desired > as.MaxInstances {
+		desired = as.MaxInstances
+	}
+
+	if desired == current {
+		return nil
+	}
+
+	if desired < current {
+		scaleMtx.Lock()
+		last := lastScaled[a.Id]
+		scaleMtx.Unlock()
+		if time.Since(last) < scaleDownDelay {
+			return nil
+		}
+	}
+
+	return Scale(a.Id, desired, "autoscaled")
+}
+
+// replicasFor returns the replicas needed to bring usage to target
+func replicasFor(current int, usage, target float64) int {
+	ratio := usage / target
+	if math.Abs(ratio-1) <= scaleTolerance {
+		return current
+	}
+	return int(math.Ceil(float64(current) * ratio))
+}
@@ -0,0 +1,276 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
+	"github.com/myodc/playground-server/server/store"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	serviceNamespace = "playground:services"
+)
+
+func genPassword() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Provision creates an instance of a catalog service and the app it
+// runs as. The app is returned to be started.
+func Provision(template, id, ns string) (*ServiceInstance, *App, error) {
+	t, ok := catalog[template]
+	if !ok {
+		return nil, nil, fmt.Errorf("Unknown service %s", template)
+	}
+
+	password, err := genPassword()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	svc := &ServiceInstance{
+		Id:        id,
+		Template:  t.Name,
+		Namespace: ns,
+		Password:  password,
+		Created:   time.Now(),
+	}
+
+	a := &App{
+		Id:          id,
+		Namespace:   ns,
+		Description: t.Description,
+		Source:      &Source{Image: t.Image},
+		Config: &Config{
+			NumInstances:  1,
+			ContainerPort: t.Port,
+			Ports: []runtime.Port{{
+				Name:          t.Name,
+				ContainerPort: t.Port,
+				Protocol:      runtime.ProtocolTCP,
+			}},
+			HealthCheck: &runtime.HealthCheck{
+				Type: runtime.HealthTCP,
+				Port: t.Port,
+			},
+			Env: expandEnv(t.Env, map[string]string{"PASSWORD": password}),
+		},
+	}
+
+	if len(t.DataPath) > 0 {
+		a.Config.Volumes = []runtime.Volume{{
+			Name:      "data",
+			MountPath: t.DataPath,
+		}}
+	}
+
+	if err := Create(a); err != nil {
+		return nil, nil, err
+	}
+
+	if err := saveService(svc); err != nil {
+		Delete(a.Id, true)
+		return nil, nil, err
+	}
+
+	return svc, a, nil
+}
+
+func saveService(svc *ServiceInstance) error {
+	b, err := json.Marshal(svc)
+	if err != nil {
+		return err
+	}
+	return store.Put(serviceNamespace, svc.Id, b)
+}
+
+func ReadService(id string) (*ServiceInstance, error) {
+	b, err := store.Get(serviceNamespace, id)
+	if err != nil {
+		return nil, err
+	}
+	var svc *ServiceInstance
+	if err := json.Unmarshal(b, &svc); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+func ListServices(offset, limit int) ([]*ServiceInstance, error) {
+	results, err := store.Range(serviceNamespace, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	var services []*ServiceInstance
+	for _, result := range results {
+		var svc *ServiceInstance
+		if err := json.Unmarshal(result, &svc); err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// Bind sets the connection details of a service in the env of an
+// app. They apply from the next time the app is started.
+func Bind(id, appId string) error {
+	svc, err := ReadService(id)
+	if err != nil {
+		return err
+	}
+
+	if appId == svc.Id {
+		return fmt.Errorf("Service cannot be bound to itself")
+	}
+
+	_, err = modify(appId, func(a *App) error {
+		if contains(a.Config.Services, id) {
+			return errUnchanged
+		}
+		a.Config.Services = append(a.Config.Services, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !contains(svc.Bindings, appId) {
+		svc.Bindings = append(svc.Bindings, appId)
+		return saveService(svc)
+	}
+
+	return nil
+}
+
+// Unbind removes a service from the env of an app. The service
+// is deprovisioned once it is no longer bound to any app.
+func Unbind(id, appId string) error {
+	svc, err := ReadService(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = modify(appId, func(a *App) error {
+		if !contains(a.Config.Services, id) {
+			return errUnchanged
+		}
+		a.Config.Services = remove(a.Config.Services, id)
+		return nil
+	})
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	svc.Bindings = remove(svc.Bindings, appId)
+	if len(svc.Bindings) > 0 {
+		return saveService(svc)
+	}
+
+	return Deprovision(id)
+}
+
+// Deprovision deletes a service and its data. Bound apps must be unbound first.
+func Deprovision(id string) error {
+	svc, err := ReadService(id)
+	if err != nil {
+		return err
+	}
+
+	if len(svc.Bindings) > 0 {
+		return fmt.Errorf("Service is bound to %v", svc.Bindings)
+	}
+
+	if err := store.Del(serviceNamespace, id); err != nil {
+		return err
+	}
+
+	return Delete(id, true)
+}
+
+// releaseServices unbinds the services of a deleted app, or the
+// apps of a deleted service
+func releaseServices(a *App) {
+	for _, id := range a.Config.Services {
+		if err := Unbind(id, a.Id); err != nil {
+			log.Errorf("Error unbinding %s from %s: %v", id, a.Id, err)
+		}
+	}
+
+	svc, err := ReadService(a.Id)
+	if err != nil {
+		return
+	}
+
+	for _, appId := range svc.Bindings {
+		_, err := modify(appId, func(bound *App) error {
+			bound.Config.Services = remove(bound.Config.Services, svc.Id)
+			return nil
+		})
+		if err != nil && err != store.ErrNotFound {
+			log.Errorf("Error unbinding %s from %s: %v", svc.Id, appId, err)
+		}
+	}
+
+	if err := store.Del(serviceNamespace, svc.Id); err != nil {
+		log.Errorf("Error removing service %s: %v", svc.Id, err)
+	}
+}
+
+// serviceEnv returns the env an app bound to a service gets
+func serviceEnv(id string) (map[string]string, error) {
+	svc, err := ReadService(id)
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := catalog[svc.Template]
+	if !ok {
+		return nil, fmt.Errorf("Unknown service %s", svc.Template)
+	}
+
+	service, err := Endpoint(svc.Id)
+	if err != nil {
+		return nil, fmt.Errorf("Service %s not started", svc.Id)
+	}
+
+	vars := map[string]string{
+		"HOST":     service.IP,
+		"PORT":     strconv.Itoa(service.Port),
+		"PASSWORD": svc.Password,
+	}
+	vars["URL"] = expand(t.URL, vars)
+
+	env := expandEnv(t.Bind, vars)
+	env[envPrefix(svc.Id)+"_URL"] = vars["URL"]
+	return env, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,408 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
+	"github.com/myodc/playground-server/server/store"
+)
+
+var (
+	stackNamespace = "playground:stacks"
+	// stack of each member app
+	stackAppsNamespace = "playground:stacks:apps"
+
+	// how long a member has to become healthy
+	// before its dependents are started
+	maxDependencyWait = 5 * time.Minute
+)
+
+func CreateStack(s *Stack) error {
+	if !nameRe.MatchString(s.Id) {
+		return fmt.Errorf("Stack Id invalid. Must match %s", nameRe.String())
+	}
+
+	exists, err := store.Exists(stackNamespace, s.Id)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return fmt.Errorf("Stack already exists")
+	}
+
+	return UpdateStack(s)
+}
+
+func UpdateStack(s *Stack) error {
+	if err := validateStack(s); err != nil {
+		return err
+	}
+
+	if s.Created.IsZero() {
+		s.Created = time.Now()
+	}
+	s.Updated = time.Now()
+
+	// the stack and the index of its apps are saved together
+	batch := store.NewBatch()
+
+	// release apps no longer in the stack
+	if old, err := ReadStack(s.Id); err == nil {
+		for _, m := range old.Members {
+			if s.member(m.AppId) == nil {
+				batch.Del(stackAppsNamespace, m.AppId)
+			}
+		}
+	}
+
+	for _, m := range s.Members {
+		batch.Put(stackAppsNamespace, m.AppId, []byte(s.Id))
+	}
+
+	if err := saveStack(batch, s); err != nil {
+		return err
+	}
+
+	return batch.Exec()
+}
+
+func saveStack(batch *store.Batch, s *Stack) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	batch.Put(stackNamespace, s.Id, b)
+	return nil
+}
+
+func ReadStack(id string) (*Stack, error) {
+	b, err := store.Get(stackNamespace, id)
+	if err != nil {
+		return nil, err
+	}
+	var s *Stack
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func ListStacks(offset, limit int) ([]*Stack, error) {
+	results, err := store.Range(stackNamespace, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	var stacks []*Stack
+	for _, result := range results {
+		var s *Stack
+		if err := json.Unmarshal(result, &s); err != nil {
+			return nil, err
+		}
+		stacks = append(stacks, s)
+	}
+	return stacks, nil
+}
+
+// DeleteStack removes a stack and deletes its apps, dependents
+// first. Volumes are kept unless purge is set.
+func DeleteStack(id string, purge bool) error {
+	s, err := ReadStack(id)
+	if err != nil {
+		return err
+	}
+
+	order, err := s.Order()
+	if err != nil {
+		return err
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		if err := Delete(order[i], purge); err != nil {
+			return fmt.Errorf("Error deleting %s: %v", order[i], err)
+		}
+	}
+
+	return store.Del(stackNamespace, id)
+}
+
+// stackOf returns the stack an app is a member of
+func stackOf(id string) (*Stack, error) {
+	b, err := store.Get(stackAppsNamespace, id)
+	if err != nil {
+		return nil, err
+	}
+	return ReadStack(string(b))
+}
+
+// leaveStack removes a deleted app from its stack along
+// with the dependencies of other members on it
+func leaveStack(id string) error {
+	s, err := stackOf(id)
+	if err == store.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var members []*Member
+	for _, m := range s.Members {
+		if m.AppId == id {
+			continue
+		}
+		var deps []string
+		for _, dep := range m.DependsOn {
+			if dep != id {
+				deps = append(deps, dep)
+			}
+		}
+		m.DependsOn = deps
+		members = append(members, m)
+	}
+	s.Members = members
+	s.Updated = time.Now()
+
+	batch := store.NewBatch().Del(stackAppsNamespace, id)
+	if err := saveStack(batch, s); err != nil {
+		return err
+	}
+
+	return batch.Exec()
+}
+
+func validateStack(s *Stack) error {
+	if !nameRe.MatchString(s.Id) {
+		return fmt.Errorf("Stack Id invalid. Must match %s", nameRe.String())
+	}
+
+	if len(s.Members) == 0 {
+		return fmt.Errorf("Stack has no apps")
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range s.Members {
+		if seen[m.AppId] {
+			return fmt.Errorf("App %s is in the stack more than once", m.AppId)
+		}
+		seen[m.AppId] = true
+
+		exists, err := store.Exists(namespace, m.AppId)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("App %s does not exist", m.AppId)
+		}
+
+		b, err := store.Get(stackAppsNamespace, m.AppId)
+		if err == nil && string(b) != s.Id {
+			return fmt.Errorf("App %s is already in stack %s", m.AppId, string(b))
+		}
+	}
+
+	for _, m := range s.Members {
+		for _, dep := range m.DependsOn {
+			if !seen[dep] {
+				return fmt.Errorf("App %s depends on %s which is not in the stack", m.AppId, dep)
+			}
+		}
+	}
+
+	_, err := s.Order()
+	return err
+}
+
+func (s *Stack) member(id string) *Member {
+	for _, m := range s.Members {
+		if m.AppId == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// Order returns the app ids of the stack in start order, each after
+// the apps it depends on and otherwise in the order they are listed
+func (s *Stack) Order() ([]string, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int)
+	var order []string
+
+	var visit func(m *Member, path []string) error
+	visit = func(m *Member, path []string) error {
+		switch state[m.AppId] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("Stack dependency cycle: %s", strings.Join(append(path, m.AppId), " -> "))
+		}
+
+		state[m.AppId] = visiting
+		for _, dep := range m.DependsOn {
+			d := s.member(dep)
+			if d == nil {
+				return fmt.Errorf("App %s depends on %s which is not in the stack", m.AppId, dep)
+			}
+			if err := visit(d, append(path, m.AppId)); err != nil {
+				return err
+			}
+		}
+		state[m.AppId] = visited
+
+		order = append(order, m.AppId)
+		return nil
+	}
+
+	for _, m := range s.Members {
+		if err := visit(m, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// Build builds and pushes the apps of the stack in start order
+func (s *Stack) Build() error {
+	order, err := s.Order()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		a, err := Read(id)
+		if err != nil {
+			return err
+		}
+
+		if err := a.Build(); err != nil {
+			return fmt.Errorf("Error building %s: %v", id, err)
+		}
+
+		if err := a.Push(); err != nil {
+			return fmt.Errorf("Error pushing %s: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Start starts the apps of the stack which are not already up. Each
+// app waits for the apps it depends on to be healthy. Jobs are left
+// to be triggered.
+func (s *Stack) Start() error {
+	order, err := s.Order()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		a, err := Read(id)
+		if err != nil {
+			return err
+		}
+
+		if a.Config.Job != nil {
+			continue
+		}
+
+		for _, dep := range s.member(id).DependsOn {
+			if err := waitHealthy(dep, maxDependencyWait); err != nil {
+				return fmt.Errorf("Not starting %s, dependency %s: %v", id, dep, err)
+			}
+		}
+
+		if status, err := Status(id); err == nil && isUp(status.Status) {
+			continue
+		}
+
+		if err := a.Start(); err != nil {
+			return fmt.Errorf("Error starting %s: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Stop stops the apps of the stack which are up, dependents first
+func (s *Stack) Stop() error {
+	order, err := s.Order()
+	if err != nil {
+		return err
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		a, err := Read(order[i])
+		if err != nil {
+			return err
+		}
+
+		if a.Config.Job != nil {
+			continue
+		}
+
+		if status, err := Status(a.Id); err == nil && !isUp(status.Status) {
+			continue
+		}
+
+		if err := a.Stop(); err != nil {
+			return fmt.Errorf("Error stopping %s: %v", a.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// waitHealthy blocks until an app passes its health check
+func waitHealthy(id string, timeout time.Duration) error {
+	a, err := Read(id)
+	if err != nil {
+		return err
+	}
+
+	// jobs run to completion so there is nothing to wait for
+	if a.Config != nil && a.Config.Job != nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		health, err := getRuntime().Health(id)
+		if err == nil && health.Status == runtime.Healthy {
+			return nil
+		}
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	return fmt.Errorf("App did not become healthy within %v", timeout)
+}
+
+// discoveryEnv returns the env vars for the address of an app,
+// <APP>_HOST and <APP>_PORT for the primary port plus
+// <APP>_<PORT>_PORT for each named port
+func discoveryEnv(id string, service *runtime.Service) map[string]string {
+	prefix := envPrefix(id)
+
+	env := map[string]string{
+		prefix + "_HOST": service.IP,
+		prefix + "_PORT": strconv.Itoa(service.Port),
+	}
+
+	for _, p := range service.Ports {
+		env[prefix+"_"+envPrefix(p.Name)+"_PORT"] = strconv.Itoa(p.Port)
+	}
+
+	return env
+}
+
+func envPrefix(name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
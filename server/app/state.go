@@ -0,0 +1,220 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/myodc/playground-server/server/events"
+	"github.com/myodc/playground-server/server/store"
+)
+
+// App statuses
+const (
+	StatusCreated  = "Created"
+	StatusBuilding = "Building"
+	StatusBuilt    = "Built"
+	StatusPushing  = "Pushing"
+	StatusPushed   = "Pushed"
+	StatusStarting = "Starting"
+	StatusStarted  = "Started"
+	StatusStopping = "Stopping"
+	StatusStopped  = "Stopped"
+	StatusIdle     = "Idle"
+	StatusWaking   = "Waking"
+	StatusFailed   = "Failed"
+	StatusDeleting = "Deleting"
+
+	// Reported by health checks and the runtime while deployed
+	StatusPending        = "Pending"
+	StatusRunning        = "Running"
+	StatusUnhealthy      = "Unhealthy"
+	StatusCrashLooping   = "CrashLooping"
+	StatusOOMKilled      = "OOMKilled"
+	StatusImagePullError = "ImagePullError"
+
+	// Outcomes of the last run of a job, Running while one is active
+	StatusSucceeded = "Succeeded"
+	StatusTimedOut  = "TimedOut"
+	StatusKilled    = "Killed"
+)
+
+var (
+	// ErrConflict is returned when the status keeps changing
+	// while being updated
+	ErrConflict = errors.New("App status changed during update")
+
+	// attempts at updating a status which is changing
+	maxStatusRetries = 5
+
+	deployed = []string{
+		StatusStarted, StatusPending, StatusRunning, StatusUnhealthy,
+		StatusCrashLooping, StatusOOMKilled, StatusImagePullError,
+	}
+
+	// transitions lists the statuses each status can move to.
+	// Jobs move to Running when a run starts.
+	transitions = map[string][]string{
+		StatusCreated:  {StatusBuilding, StatusStarting, StatusRunning, StatusFailed},
+		StatusBuilding: {StatusBuilt, StatusFailed},
+		StatusBuilt:    {StatusBuilding, StatusPushing, StatusStarting, StatusStopping, StatusRunning, StatusFailed},
+		StatusPushing:  {StatusPushed, StatusFailed},
+		StatusPushed:   {StatusBuilding, StatusStarting, StatusStopping, StatusRunning, StatusFailed},
+		// the runtime may report on instances before the start
+		// completes, a start which hangs can be stopped
+		StatusStarting: append([]string{StatusStopping, StatusFailed}, deployed...),
+		StatusStopping: {StatusStopped, StatusFailed},
+		StatusStopped:  {StatusBuilding, StatusStarting, StatusIdle, StatusRunning},
+		StatusIdle:     {StatusWaking, StatusBuilding, StatusStarting, StatusStopping},
+		StatusWaking:   {StatusStarting, StatusFailed},
+		StatusFailed:   append([]string{StatusBuilding, StatusStarting, StatusStopping}, deployed...),
+	}
+)
+
+func init() {
+	// deployed apps can be rebuilt, stopped or change health. A
+	// running job finishes or has another run start.
+	for _, status := range deployed {
+		next := []string{StatusBuilding, StatusStopping, StatusStopped, StatusFailed}
+		for _, s := range deployed {
+			if s != status {
+				next = append(next, s)
+			}
+		}
+		if status == StatusRunning {
+			next = append(next, StatusRunning, StatusSucceeded, StatusTimedOut, StatusKilled)
+		}
+		transitions[status] = next
+	}
+
+	for _, status := range []string{StatusSucceeded, StatusTimedOut, StatusKilled} {
+		transitions[status] = []string{StatusRunning, StatusBuilding, StatusStopping}
+	}
+
+	// any app can be deleted, a deleting app only has its delete
+	// retried and nothing else may change its status
+	for status, next := range transitions {
+		transitions[status] = append(next, StatusDeleting)
+	}
+	transitions[StatusDeleting] = []string{StatusDeleting}
+}
+
+// TransitionError is returned for a change the status of an app does not allow
+type TransitionError struct {
+	Id   string
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("App %s is %s, cannot move to %s", e.Id, e.From, e.To)
+}
+
+// canTransition returns true if an app can move between two
+// statuses. Apps without a status, or one from before statuses
+// were checked, can move to any status.
+func canTransition(from, to string) bool {
+	next, ok := transitions[from]
+	if !ok {
+		return true
+	}
+	for _, s := range next {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Can checks the app can move to a status from its current one,
+// so actions can be refused before they are started
+func (a *App) Can(status string) error {
+	current, err := Status(a.Id)
+	if err != nil {
+		return err
+	}
+
+	if !canTransition(current.Status, status) {
+		return &TransitionError{Id: a.Id, From: current.Status, To: status}
+	}
+
+	return nil
+}
+
+// UpdateStatus moves the app to a new status if its current status
+// allows it. The status is compared and swapped so concurrent updates
+// are checked against each other.
+// The change is added to the app's status history.
+func (a *App) UpdateStatus(info *Info) error {
+	info.AppId = a.Id
+	info.Timestamp = time.Now()
+	if len(info.Actor) == 0 {
+		info.Actor = a.actorOr(actorSystem)
+	}
+
+	for i := 0; i < maxStatusRetries; i++ {
+		old, err := store.Get(statusNamespace, a.Id)
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+
+		info.Previous = ""
+		if old != nil {
+			var current *Info
+			if err := json.Unmarshal(old, &current); err != nil {
+				return err
+			}
+			if !canTransition(current.Status, info.Status) {
+				return &TransitionError{Id: a.Id, From: current.Status, To: info.Status}
+			}
+			info.Previous = current.Status
+		}
+
+		b, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+
+		// the status and its timeline entry are written together
+		batch := store.NewBatch().Put(statusNamespace, a.Id, b)
+		addHistory(batch, info, b)
+
+		ok, err := batch.ExecIf(statusNamespace, a.Id, old)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return a.statusChanged(info)
+		}
+	}
+
+	return ErrConflict
+}
+
+// statusChanged announces a new status and trims the timeline
+func (a *App) statusChanged(info *Info) error {
+	events.Send(a.Id, events.Event{Body: info.Status, Type: events.Status})
+	return pruneHistory(a.Id)
+}
+
+// createdStatus adds the status of a new app to batch, replacing
+// any left over from a deleted app with the same id
+func (a *App) createdStatus(batch *store.Batch) (*Info, error) {
+	info := &Info{
+		AppId:     a.Id,
+		Status:    StatusCreated,
+		Actor:     a.actorOr(actorSystem),
+		Timestamp: time.Now(),
+	}
+
+	b, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	batch.Put(statusNamespace, a.Id, b)
+	addHistory(batch, info, b)
+	return info, nil
+}
@@ -2,6 +2,8 @@ package app
 
 import (
 	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
 )
 
 type App struct {
@@ -12,11 +14,48 @@ type App struct {
 	Source      *Source
 	Created     time.Time
 	Updated     time.Time
+	// Incremented on every update, updates made with an
+	// older revision are refused
+	Revision int64
+	// Tenant or project namespace the app runs in, blank for
+	// the runtime's default
+	Namespace string
+
+	// who is acting on the app, recorded with status changes
+	actor string
 }
 
 type Config struct {
-	NumInstances  int
+	NumInstances int
+	// The primary port, proxied and health checked by default
 	ContainerPort int
+	// Named ports, defaults to ContainerPort as a public http port
+	Ports []runtime.Port
+	// Persistent volumes, kept across redeploys
+	Volumes []runtime.Volume
+	// CPU and memory requests and limits, limits default
+	// to the server maximums
+	Resources *runtime.Resources
+	// Target registry and repository for built images,
+	// defaults to the playground registry
+	Registry   string
+	Repository string
+	// Optional check for liveness and readiness
+	HealthCheck *runtime.HealthCheck
+	// Optional replica range and utilisation target
+	Autoscale *runtime.Autoscale
+	// Minutes without requests after which the app is
+	// stopped until the next request, 0 to never stop
+	IdleTimeout int
+	// Environment variables set in the app's containers
+	Env map[string]string
+	// Backing service instances bound to the app, their
+	// connection details are set in its env
+	Services []string
+	// Runs the app to completion instead of as a service
+	Job *Job
+	// Deploys a copy of the app for other git branches
+	Previews *Previews
 }
 
 type Code struct {
@@ -30,16 +69,99 @@ type GitRepo struct {
 }
 
 type Info struct {
-	AppId     string
-	Status    string
-	Reason    string
-	Message   string
+	AppId   string
+	Status  string
+	Reason  string
+	Message string
+	// Who made the change, an api caller or a server
+	// component such as the health checks
+	Actor string
+	// The status moved from
+	Previous  string `json:",omitempty"`
 	Timestamp time.Time
 }
 
+// Job is an app run on a schedule or when triggered
+type Job struct {
+	// Cron spec, blank to only run when triggered
+	Schedule string
+	// What happens when a run starts while another is active,
+	// one of Allow, Forbid or Replace
+	Concurrency string
+	// Seconds an attempt may take before it is killed, 0 for no limit
+	Timeout int
+	// Attempts made after a failed one
+	Retries int
+}
+
+// Previews are copies of a git repo app built from other branches
+type Previews struct {
+	// Hours without requests or pushes after which a
+	// preview is removed, 0 to keep it until its branch
+	// is deleted
+	TTL int
+}
+
+// Preview is the copy of an app for a branch
+type Preview struct {
+	AppId  string
+	Parent string
+	Branch string
+	// Commit of the last push, blank when created by the api
+	Commit  string
+	Created time.Time
+	Updated time.Time
+}
+
+// Run is a single execution of a job
+type Run struct {
+	Id       string
+	AppId    string
+	Status   string
+	Trigger  string
+	Attempts int
+	ExitCode int
+	Error    string
+	// The tail of the output of the last attempt
+	Logs     string
+	Started  time.Time
+	Finished time.Time
+}
+
 type Source struct {
 	Code       *Code
 	Dockerfile string
 	GitRepo    *GitRepo
 	Image      string
 }
+
+// Stack is a group of apps deployed together. Members are started
+// after the members they depend on and stopped before them.
+type Stack struct {
+	Id          string
+	Description string
+	Members     []*Member
+	Created     time.Time
+	Updated     time.Time
+}
+
+// Member is an app in a stack
+type Member struct {
+	AppId string
+	// Members started first, whose addresses are
+	// set in the app's env
+	DependsOn []string
+}
+
+// ServiceInstance is a backing service provisioned from the
+// catalog. It runs as an app with the same id.
+type ServiceInstance struct {
+	Id        string
+	Template  string
+	Namespace string
+	// Generated credentials of the service
+	Password string
+	// Apps the service is bound to
+	Bindings []string
+	Created  time.Time
+}
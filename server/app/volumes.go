@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+var (
+	volumeNameRe = regexp.MustCompile("^[a-z]([a-z0-9-]*[a-z0-9])?$")
+	sizeRe       = regexp.MustCompile("^[0-9]+(Ki|Mi|Gi|Ti)?$")
+)
+
+func validateVolumes(volumes []runtime.Volume) error {
+	names := make(map[string]bool)
+	paths := make(map[string]bool)
+
+	for i := range volumes {
+		vol := &volumes[i]
+
+		if !volumeNameRe.MatchString(vol.Name) {
+			return fmt.Errorf("Volume name %q invalid. Must match %s", vol.Name, volumeNameRe.String())
+		}
+		if names[vol.Name] {
+			return fmt.Errorf("Volume %s declared more than once", vol.Name)
+		}
+		names[vol.Name] = true
+
+		if !path.IsAbs(vol.MountPath) {
+			return fmt.Errorf("Volume %s mount path must be absolute", vol.Name)
+		}
+		vol.MountPath = path.Clean(vol.MountPath)
+		if paths[vol.MountPath] {
+			return fmt.Errorf("Mount path %s used more than once", vol.MountPath)
+		}
+		paths[vol.MountPath] = true
+
+		if len(vol.Size) == 0 {
+			vol.Size = "1Gi"
+		}
+		if !sizeRe.MatchString(vol.Size) {
+			return fmt.Errorf("Volume %s size %q invalid, e.g. 500Mi or 1Gi", vol.Name, vol.Size)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/docker"
+	log "github.com/cihub/seelog"
+)
+
+// Entry is a cached build for an app
+type Entry struct {
+	Id       string
+	Dir      string
+	Size     int64
+	LastUsed time.Time
+}
+
+var (
+	// records the image kept for a cache
+	imageFile = ".image"
+
+	// default budget of 10GB
+	defaultSize int64 = 10 << 30
+
+	// caches held by a build or being removed
+	mtx   sync.Mutex
+	freed = sync.NewCond(&mtx)
+	inUse = make(map[string]bool)
+)
+
+func root() string {
+	if dir := os.Getenv("PLAYGROUND_CACHE_DIR"); len(dir) > 0 {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "playground-cache")
+}
+
+// budget returns the disk budget in bytes. PLAYGROUND_CACHE_SIZE is in megabytes.
+func budget() int64 {
+	size := os.Getenv("PLAYGROUND_CACHE_SIZE")
+	if len(size) == 0 {
+		return defaultSize
+	}
+
+	mb, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		log.Errorf("Invalid PLAYGROUND_CACHE_SIZE %s: %v", size, err)
+		return defaultSize
+	}
+
+	return mb << 20
+}
+
+// Acquire returns the build cache directory for an app and marks it
+// as in use so it won't be evicted. A cache is held by one build at a
+// time, concurrent builds of an app wait for it. Release must be called
+// when done. The image is the app's image which is kept as a cache source.
+func Acquire(id, image string) (string, error) {
+	mtx.Lock()
+	for inUse[id] {
+		freed.Wait()
+	}
+	inUse[id] = true
+	mtx.Unlock()
+
+	dir, err := prepare(id, image)
+	if err != nil {
+		Release(id)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func prepare(id, image string) (string, error) {
+	dir := filepath.Join(root(), id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, imageFile), []byte(image), 0644); err != nil {
+		return "", err
+	}
+
+	// mtime of the dir tracks last use
+	now := time.Now()
+	if err := os.Chtimes(dir, now, now); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// Release marks the cache for an app as no longer in use
+func Release(id string) {
+	mtx.Lock()
+	delete(inUse, id)
+	mtx.Unlock()
+	freed.Broadcast()
+}
+
+// Remove deletes the build cache and local image of an app. The
+// cache is held while it is removed so a build can't acquire it.
+func Remove(id string) error {
+	mtx.Lock()
+	if inUse[id] {
+		mtx.Unlock()
+		return fmt.Errorf("Cache for %s is in use", id)
+	}
+	inUse[id] = true
+	mtx.Unlock()
+
+	defer Release(id)
+
+	dir := filepath.Join(root(), id)
+	image := cachedImage(dir)
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if len(image) > 0 && docker.Exists(image, "latest") {
+		return docker.Remove(image, "latest")
+	}
+
+	return nil
+}
+
+// List returns the cache entries ordered by least recently used
+func List() ([]*Entry, error) {
+	infos, err := ioutil.ReadDir(root())
+	if os.IsNotExist(err) {
+		return []*Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(root(), info.Name())
+		size, err := dirSize(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		// account for the image kept as a cache source
+		if image := cachedImage(dir); len(image) > 0 {
+			size += docker.Size(image, "latest")
+		}
+
+		entries = append(entries, &Entry{
+			Id:       info.Name(),
+			Dir:      dir,
+			Size:     size,
+			LastUsed: info.ModTime(),
+		})
+	}
+
+	sort.Sort(byLastUsed(entries))
+	return entries, nil
+}
+
+// Evict removes least recently used caches until within the disk budget
+func Evict() error {
+	entries, err := List()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	max := budget()
+
+	for _, entry := range entries {
+		if total <= max {
+			break
+		}
+
+		log.Infof("Evicting build cache for %s (%d bytes)", entry.Id, entry.Size)
+		if err := Remove(entry.Id); err != nil {
+			log.Errorf("Couldn't evict build cache for %s: %v", entry.Id, err)
+			continue
+		}
+		total -= entry.Size
+	}
+
+	return nil
+}
+
+// Run evicts caches periodically. Blocking.
+func Run(interval time.Duration) {
+	for {
+		if err := Evict(); err != nil {
+			log.Errorf("Error evicting build cache: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func cachedImage(dir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, imageFile))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+type byLastUsed []*Entry
+
+func (b byLastUsed) Len() int           { return len(b) }
+func (b byLastUsed) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byLastUsed) Less(i, j int) bool { return b[i].LastUsed.Before(b[j].LastUsed) }
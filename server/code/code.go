@@ -3,6 +3,7 @@ package code
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -18,6 +19,9 @@ type Code struct {
 }
 
 var (
+	// ErrIdTaken is returned when saving code to an id in use
+	ErrIdTaken = errors.New("Code id already taken")
+
 	alphanum        = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
 	templateProject = "https://github.com/myodc/playground-server/server"
 	namespace       = "playground:code"
@@ -52,13 +56,39 @@ func Load(id string) (string, error) {
 	return string(code), nil
 }
 
-// Save a piece of code for sharing
+// Save a piece of code for sharing. Shared code is never
+// overwritten, saving to an id which is taken fails.
 func Save(id string, code *Code) error {
 	b, err := json.Marshal(code)
 	if err != nil {
 		return err
 	}
-	return store.Put(namespace, id, b)
+
+	ok, err := store.NewBatch().Put(namespace, id, b).ExecIf(namespace, id, nil)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrIdTaken
+	}
+
+	return nil
+}
+
+// Share saves a piece of code under a new short id, generating
+// another if the id is taken in the meantime
+func Share(code *Code) (string, error) {
+	for i := 0; i < 10; i++ {
+		id := GenShortId()
+		err := Save(id, code)
+		if err == ErrIdTaken {
+			continue
+		}
+		return id, err
+	}
+
+	return "", ErrIdTaken
 }
 
 // Run a one off short lived app
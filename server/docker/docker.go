@@ -32,7 +32,9 @@ func newClient() (*dcli.Client, error) {
 	return dcli.NewClient(endpoint)
 }
 
-func Build(name, tag, dir string, out io.Writer) error {
+// Build builds the context in dir as image:tag, where image is
+// the full repository name as returned by Image or ImageFor
+func Build(image, tag, dir string, out io.Writer) error {
 	options := &archive.TarOptions{
 		Compression: archive.Uncompressed,
 	}
@@ -49,10 +51,11 @@ func Build(name, tag, dir string, out io.Writer) error {
 	}
 
 	opts := dcli.BuildImageOptions{
-		Name:           fmt.Sprintf("%s/%s:%s", registry(), name, tag),
+		Name:           fmt.Sprintf("%s:%s", image, tag),
 		InputStream:    in,
 		OutputStream:   out,
 		RmTmpContainer: true,
+		AuthConfigs:    authConfigs(),
 	}
 
 	// new docker client
@@ -80,7 +83,7 @@ func Exists(image, tag string) bool {
 		return false
 	}
 
-	_, err = client.InspectImage(image + ":" + tag)
+	_, err = client.InspectImage(Reference(image, tag))
 	if err != nil {
 		return false
 	}
@@ -98,10 +101,19 @@ func Pull(image, tag string, out io.Writer) error {
 		Repository:   image,
 		Tag:          tag,
 		OutputStream: out,
-	}, dcli.AuthConfiguration{})
+	}, authFor(image))
 }
 
-func Push(name, tag string, rmImage bool, out io.Writer) error {
+// Warm pulls the last pushed image of an app so its layers
+// can be used as a cache source by the next build
+func Warm(image, tag string, out io.Writer) error {
+	if Exists(image, tag) {
+		return nil
+	}
+	return Pull(image, tag, out)
+}
+
+func Push(image, tag string, rmImage bool, out io.Writer) error {
 	// new docker client
 	client, err := newClient()
 	if err != nil {
@@ -109,19 +121,66 @@ func Push(name, tag string, rmImage bool, out io.Writer) error {
 	}
 
 	popts := dcli.PushImageOptions{
-		Name:         fmt.Sprintf("%s/%s", registry(), name),
+		Name:         image,
 		Tag:          tag,
-		Registry:     registry(),
+		Registry:     registryHost(image),
 		OutputStream: out,
 	}
 
-	if err := client.PushImage(popts, dcli.AuthConfiguration{}); err != nil {
+	if err := client.PushImage(popts, authFor(image)); err != nil {
 		return err
 	}
 
+	// track releases for garbage collection
+	if tag != "latest" {
+		if err := record(image, tag); err != nil {
+			return err
+		}
+	}
+
 	if rmImage {
-		return client.RemoveImage(fmt.Sprintf("%s/%s:%s", registry(), name, tag))
+		return client.RemoveImage(Reference(image, tag))
 	}
 
 	return nil
 }
+
+// Tag tags the local image src as image:tag
+func Tag(src, image, tag string) error {
+	// new docker client
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return client.TagImage(src, dcli.TagImageOptions{
+		Repo:  image,
+		Tag:   tag,
+		Force: true,
+	})
+}
+
+func Remove(image, tag string) error {
+	// new docker client
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return client.RemoveImage(Reference(image, tag))
+}
+
+// Size returns the virtual size of a local image or 0 if it does not exist
+func Size(image, tag string) int64 {
+	// new docker client
+	client, err := newClient()
+	if err != nil {
+		return 0
+	}
+
+	img, err := client.InspectImage(Reference(image, tag))
+	if err != nil {
+		return 0
+	}
+	return img.VirtualSize
+}
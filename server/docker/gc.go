@@ -0,0 +1,412 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myodc/playground-server/server/store"
+	log "github.com/cihub/seelog"
+	dcli "github.com/fsouza/go-dockerclient"
+)
+
+// Release is a versioned image pushed to a registry
+type Release struct {
+	Image  string
+	Tag    string
+	Pushed time.Time
+}
+
+// Repository is an image repository known to the garbage collector
+type Repository struct {
+	Image   string
+	Deleted bool
+}
+
+// Policy is the image retention policy
+type Policy struct {
+	// Number of releases kept per app
+	KeepReleases int
+	// Remove dangling images from the docker host
+	PruneLocal bool
+	// Images referenced by apps, image:tag, which are never removed
+	InUse []string
+}
+
+// Action is an image removal carried out, or planned in a dry run
+type Action struct {
+	Image  string
+	Tag    string
+	Target string
+	Reason string
+}
+
+// Report is the result of a garbage collection run
+type Report struct {
+	DryRun  bool
+	Actions []*Action
+	Errors  []string
+}
+
+const (
+	targetLocal    = "local"
+	targetRegistry = "registry"
+)
+
+var (
+	imagesNamespace   = "playground:images"
+	releasesNamespace = "playground:images:releases:"
+	defaultKeep       = 5
+)
+
+// DefaultPolicy returns the policy set by PLAYGROUND_GC_KEEP
+func DefaultPolicy() *Policy {
+	keep := defaultKeep
+	if k, err := strconv.Atoi(os.Getenv("PLAYGROUND_GC_KEEP")); err == nil && k > 0 {
+		keep = k
+	}
+
+	return &Policy{
+		KeepReleases: keep,
+		PruneLocal:   true,
+	}
+}
+
+func record(image, tag string) error {
+	b, err := json.Marshal(&Repository{Image: image})
+	if err != nil {
+		return err
+	}
+	if err := store.Put(imagesNamespace, image, b); err != nil {
+		return err
+	}
+
+	b, err = json.Marshal(&Release{Image: image, Tag: tag, Pushed: time.Now()})
+	if err != nil {
+		return err
+	}
+	return store.Put(releasesNamespace+image, tag, b)
+}
+
+// Forget marks a repository as deleted so all its images are collected
+func Forget(image string) error {
+	exists, err := store.Exists(imagesNamespace, image)
+	if err != nil || !exists {
+		return err
+	}
+
+	b, err := json.Marshal(&Repository{Image: image, Deleted: true})
+	if err != nil {
+		return err
+	}
+	return store.Put(imagesNamespace, image, b)
+}
+
+// Releases returns the releases of an image, newest first
+func Releases(image string) ([]*Release, error) {
+	results, err := store.Range(releasesNamespace+image, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []*Release
+	for _, result := range results {
+		var release *Release
+		if err := json.Unmarshal(result, &release); err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// GC removes images according to the policy. With dryRun
+// set it only reports what would be removed.
+func GC(policy *Policy, dryRun bool) (*Report, error) {
+	results, err := store.Range(imagesNamespace, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{DryRun: dryRun}
+
+	inUse := make(map[string]bool)
+	for _, image := range policy.InUse {
+		inUse[image] = true
+	}
+
+	for _, result := range results {
+		var repo *Repository
+		if err := json.Unmarshal(result, &repo); err != nil {
+			return nil, err
+		}
+
+		releases, err := Releases(repo.Image)
+		if err != nil {
+			return nil, err
+		}
+
+		// tags which stay, the latest tag is the build cache of a live app
+		var kept []string
+		if !repo.Deleted {
+			kept = append(kept, "latest")
+		}
+
+		var expired []*Release
+		var reasons []string
+		for i, release := range releases {
+			switch {
+			case inUse[repo.Image+":"+release.Tag]:
+				kept = append(kept, release.Tag)
+			case repo.Deleted:
+				expired = append(expired, release)
+				reasons = append(reasons, "app deleted")
+			case i >= policy.KeepReleases:
+				expired = append(expired, release)
+				reasons = append(reasons, fmt.Sprintf("older than last %d releases", policy.KeepReleases))
+			default:
+				kept = append(kept, release.Tag)
+			}
+		}
+
+		// identical builds share a manifest, which is only deleted
+		// from the registry if no kept tag points at it
+		var keptDigests map[string]bool
+		digests := func() (map[string]bool, error) {
+			if keptDigests != nil {
+				return keptDigests, nil
+			}
+			d, err := resolveDigests(repo.Image, kept)
+			keptDigests = d
+			return d, err
+		}
+
+		for i, release := range expired {
+			tag := release.Tag
+			report.remove(repo.Image, tag, targetRegistry, reasons[i], func() error {
+				keep, err := digests()
+				if err != nil {
+					return err
+				}
+				if err := removeRelease(repo.Image, tag, keep); err != nil {
+					return err
+				}
+				return store.Del(releasesNamespace+repo.Image, tag)
+			})
+		}
+
+		if !repo.Deleted {
+			continue
+		}
+
+		if Exists(repo.Image, "latest") {
+			report.remove(repo.Image, "latest", targetLocal, "app deleted", func() error {
+				return Remove(repo.Image, "latest")
+			})
+		}
+
+		// latest may have been pushed by older builds
+		report.remove(repo.Image, "latest", targetRegistry, "app deleted", func() error {
+			keep, err := digests()
+			if err != nil {
+				return err
+			}
+			return deleteManifest(repo.Image, "latest", keep)
+		})
+
+		// releases still in use keep the repository known
+		if !dryRun && len(kept) == 0 {
+			if err := store.Del(imagesNamespace, repo.Image); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+		}
+	}
+
+	if policy.PruneLocal {
+		if err := report.pruneLocal(); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	return report, nil
+}
+
+// RunGC collects images periodically using the default policy,
+// keeping the images returned by inUse. Blocking.
+func RunGC(interval time.Duration, inUse func() ([]string, error)) {
+	for {
+		report, err := collect(inUse)
+		if err != nil {
+			log.Errorf("Error collecting images: %v", err)
+		} else {
+			log.Infof("Image gc removed %d images with %d errors", len(report.Actions), len(report.Errors))
+		}
+		time.Sleep(interval)
+	}
+}
+
+func collect(inUse func() ([]string, error)) (*Report, error) {
+	images, err := inUse()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := DefaultPolicy()
+	policy.InUse = images
+	return GC(policy, false)
+}
+
+func (r *Report) remove(image, tag, target, reason string, fn func() error) {
+	r.Actions = append(r.Actions, &Action{
+		Image:  image,
+		Tag:    tag,
+		Target: target,
+		Reason: reason,
+	})
+
+	if r.DryRun {
+		return
+	}
+
+	if err := fn(); err != nil {
+		r.Errors = append(r.Errors, fmt.Sprintf("%s:%s: %v", image, tag, err))
+	}
+}
+
+func (r *Report) pruneLocal() error {
+	// new docker client
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	images, err := client.ListImages(dcli.ListImagesOptions{
+		Filters: map[string][]string{"dangling": {"true"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		id := image.ID
+		r.Actions = append(r.Actions, &Action{
+			Image:  id,
+			Target: targetLocal,
+			Reason: "dangling",
+		})
+
+		if r.DryRun {
+			continue
+		}
+
+		if err := client.RemoveImage(id); err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: %v", id, err))
+		}
+	}
+
+	return nil
+}
+
+// removeRelease deletes a tag from the registry and the docker host
+func removeRelease(image, tag string, keep map[string]bool) error {
+	if Exists(image, tag) {
+		if err := Remove(image, tag); err != nil {
+			return err
+		}
+	}
+
+	return deleteManifest(image, tag, keep)
+}
+
+// manifestURL returns the registry v2 api url of an image's manifests
+func manifestURL(image string) string {
+	return registryAPI(image) + "/manifests/"
+}
+
+// resolveDigest returns the digest of an image tag in the registry,
+// blank if the tag is not there
+func resolveDigest(image, tag string) (string, error) {
+	req, err := http.NewRequest("HEAD", manifestURL(image)+tag, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	setAuth(req, image)
+
+	rsp, err := registryClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error resolving manifest: %s", rsp.Status)
+	}
+
+	digest := rsp.Header.Get("Docker-Content-Digest")
+	if len(digest) == 0 {
+		return "", fmt.Errorf("Registry returned no digest for %s:%s", image, tag)
+	}
+
+	return digest, nil
+}
+
+func resolveDigests(image string, tags []string) (map[string]bool, error) {
+	digests := make(map[string]bool)
+	for _, tag := range tags {
+		digest, err := resolveDigest(image, tag)
+		if err != nil {
+			return nil, err
+		}
+		if len(digest) > 0 {
+			digests[digest] = true
+		}
+	}
+	return digests, nil
+}
+
+// deleteManifest deletes an image tag using the registry v2 api.
+// Manifests are deleted by digest so one in keep, shared with a
+// kept tag, is left in place.
+func deleteManifest(image, tag string, keep map[string]bool) error {
+	digest, err := resolveDigest(image, tag)
+	if err != nil || len(digest) == 0 {
+		return err
+	}
+
+	if keep[digest] {
+		log.Debugf("Not deleting %s:%s, its manifest %s is shared with a kept tag", image, tag, digest)
+		return nil
+	}
+
+	req, err := http.NewRequest("DELETE", manifestURL(image)+digest, nil)
+	if err != nil {
+		return err
+	}
+	setAuth(req, image)
+
+	rsp, err := registryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusAccepted && rsp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("Error deleting manifest: %s", rsp.Status)
+	}
+
+	return nil
+}
+
+func setAuth(req *http.Request, image string) {
+	if auth := authFor(image); len(auth.Username) > 0 {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+}
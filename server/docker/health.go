@@ -0,0 +1,260 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	dcli "github.com/fsouza/go-dockerclient"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+// monitor polls the health checks of an app's containers
+// applying the thresholds as kubelet would for probes
+type monitor struct {
+	check *runtime.HealthCheck
+	port  int
+	exit  chan bool
+
+	sync.RWMutex
+	states map[string]*checkState
+}
+
+type checkState struct {
+	// set once a threshold has been reached
+	decided   bool
+	healthy   bool
+	successes int
+	failures  int
+}
+
+func (d *dockerRuntime) watch(name string, hc *runtime.HealthCheck, port int) {
+	d.unwatch(name)
+
+	check := *hc
+	check.Defaults()
+
+	m := &monitor{
+		check:  &check,
+		port:   port,
+		exit:   make(chan bool),
+		states: make(map[string]*checkState),
+	}
+
+	d.Lock()
+	d.monitors[name] = m
+	d.Unlock()
+
+	go m.run(name)
+}
+
+func (d *dockerRuntime) unwatch(name string) {
+	d.Lock()
+	defer d.Unlock()
+
+	if m, ok := d.monitors[name]; ok {
+		close(m.exit)
+		delete(d.monitors, name)
+	}
+}
+
+func (m *monitor) run(name string) {
+	select {
+	case <-m.exit:
+		return
+	case <-time.After(time.Duration(m.check.InitialDelay) * time.Second):
+	}
+
+	ticker := time.NewTicker(time.Duration(m.check.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		m.poll(name)
+
+		select {
+		case <-m.exit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *monitor) poll(name string) {
+	client, err := newClient()
+	if err != nil {
+		return
+	}
+
+	list, err := containers(client, name)
+	if err != nil {
+		return
+	}
+
+	states := make(map[string]*checkState)
+
+	for _, c := range list {
+		var state checkState
+
+		m.RLock()
+		if s, ok := m.states[c.ID]; ok {
+			state = *s
+		}
+		m.RUnlock()
+
+		if err := m.probe(client, c.ID); err != nil {
+			state.successes = 0
+			state.failures++
+			if state.failures >= m.check.FailureThreshold {
+				state.decided = true
+				state.healthy = false
+			}
+		} else {
+			state.failures = 0
+			state.successes++
+			if state.successes >= m.check.SuccessThreshold {
+				state.decided = true
+				state.healthy = true
+			}
+		}
+
+		states[c.ID] = &state
+	}
+
+	m.Lock()
+	m.states = states
+	m.Unlock()
+}
+
+func (m *monitor) probe(client *dcli.Client, id string) error {
+	info, err := client.InspectContainer(id)
+	if err != nil {
+		return err
+	}
+
+	if !info.State.Running {
+		return fmt.Errorf("Container not running")
+	}
+
+	port := m.check.Port
+	if port == 0 {
+		port = m.port
+	}
+
+	addr := net.JoinHostPort(info.NetworkSettings.IPAddress, strconv.Itoa(port))
+	timeout := time.Duration(m.check.Timeout) * time.Second
+
+	switch m.check.Type {
+	case runtime.HealthHTTP:
+		c := &http.Client{Timeout: timeout}
+		rsp, err := c.Get("http://" + addr + m.check.Path)
+		if err != nil {
+			return err
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode < 200 || rsp.StatusCode >= 400 {
+			return fmt.Errorf("Health check returned %s", rsp.Status)
+		}
+	case runtime.HealthTCP:
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case runtime.HealthExec:
+		return execCheck(client, id, m.check.Command)
+	}
+
+	return nil
+}
+
+func execCheck(client *dcli.Client, id string, cmd []string) error {
+	exec, err := client.CreateExec(dcli.CreateExecOptions{
+		Container:    id,
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := client.StartExec(exec.ID, dcli.StartExecOptions{
+		OutputStream: &out,
+		ErrorStream:  &out,
+	}); err != nil {
+		return err
+	}
+
+	info, err := client.InspectExec(exec.ID)
+	if err != nil {
+		return err
+	}
+
+	if info.ExitCode != 0 {
+		return fmt.Errorf("Health check exited %d: %s", info.ExitCode, out.String())
+	}
+
+	return nil
+}
+
+// Health reports the results of polled health checks or, for apps
+// without checks, whether their containers are running
+func (d *dockerRuntime) Health(name string) (*runtime.Health, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := containers(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	d.RLock()
+	m, ok := d.monitors[name]
+	d.RUnlock()
+
+	health := &runtime.Health{
+		Instances: len(list),
+		Checked:   time.Now(),
+	}
+
+	var pending int
+	for _, c := range list {
+		if !ok {
+			info, err := client.InspectContainer(c.ID)
+			if err == nil && info.State.Running {
+				health.Healthy++
+			}
+			continue
+		}
+
+		m.RLock()
+		state, checked := m.states[c.ID]
+		m.RUnlock()
+
+		switch {
+		case !checked || !state.decided:
+			pending++
+		case state.healthy:
+			health.Healthy++
+		}
+	}
+
+	switch {
+	case health.Instances > 0 && health.Healthy == health.Instances:
+		health.Status = runtime.Healthy
+	case health.Instances == 0 || health.Healthy+pending == health.Instances:
+		health.Status = runtime.Starting
+	default:
+		health.Status = runtime.Unhealthy
+	}
+
+	health.Message = fmt.Sprintf("%d/%d instances healthy", health.Healthy, health.Instances)
+	return health, nil
+}
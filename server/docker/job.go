@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	dcli "github.com/fsouza/go-dockerclient"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+var (
+	// job containers are kept apart from the instances of an app
+	jobLabel = "playground.job"
+)
+
+func jobContainerName(name, run string) string {
+	return fmt.Sprintf("playground-%s-run-%s", name, run)
+}
+
+// Run runs a job in a container without a restart policy,
+// following its logs until it exits
+func (d *dockerRuntime) Run(name, run string, job *runtime.Job, out io.Writer) (int, error) {
+	client, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+
+	image, tag := SplitImage(job.Image)
+	if !Exists(image, tag) {
+		if err := Pull(image, tag, ioutil.Discard); err != nil {
+			return 0, err
+		}
+	}
+
+	// jobs share the volumes of the app
+	binds, err := createVolumes(client, name, job.Volumes)
+	if err != nil {
+		return 0, err
+	}
+
+	labels := map[string]string{jobLabel: name}
+	for k, v := range job.Labels {
+		labels[k] = v
+	}
+
+	container, err := client.CreateContainer(dcli.CreateContainerOptions{
+		Name: jobContainerName(name, run),
+		Config: &dcli.Config{
+			Image:  job.Image,
+			Env:    env(job.Env),
+			Labels: labels,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	defer client.RemoveContainer(dcli.RemoveContainerOptions{ID: container.ID, Force: true})
+
+	hostConfig := &dcli.HostConfig{Binds: binds}
+	setResources(hostConfig, job.Resources)
+
+	if err := client.StartContainer(container.ID, hostConfig); err != nil {
+		return 0, err
+	}
+
+	// returns once the container exits
+	if err := client.Logs(dcli.LogsOptions{
+		Container:    container.ID,
+		OutputStream: out,
+		ErrorStream:  out,
+		Stdout:       true,
+		Stderr:       true,
+		Follow:       true,
+	}); err != nil {
+		return 0, err
+	}
+
+	return client.WaitContainer(container.ID)
+}
+
+// Kill removes the container of a run
+func (d *dockerRuntime) Kill(name, run string) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return client.RemoveContainer(dcli.RemoveContainerOptions{
+		ID:    jobContainerName(name, run),
+		Force: true,
+	})
+}
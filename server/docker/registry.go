@@ -1,14 +1,57 @@
 package docker
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	dcli "github.com/fsouza/go-dockerclient"
 )
 
 var (
-	repository = "playground"
+	repository   = "playground"
+	dockerHub    = "https://index.docker.io/v1/"
+	dockerHubAPI = "registry-1.docker.io"
+
+	authOnce sync.Once
+	auths    map[string]dcli.AuthConfiguration
+
+	// client for registry api calls, which are made while handling
+	// requests and collecting garbage
+	registryClient = &http.Client{Timeout: 10 * time.Second}
+
+	// how long an image is known to be private or public for
+	privateTTL = time.Hour
+	privateMtx sync.Mutex
+	private    = make(map[string]*privateCheck)
 )
 
+type privateCheck struct {
+	private bool
+	checked time.Time
+}
+
+// dockerConfig is the format of ~/.docker/config.json
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
 func registry() string {
 	host := os.Getenv("PLAYGROUND_REGISTRY_SERVICE_HOST")
 	port := os.Getenv("PLAYGROUND_REGISTRY_SERVICE_PORT")
@@ -19,3 +62,300 @@ func registry() string {
 
 	return filepath.Join("localhost:5000", repository)
 }
+
+// loadAuths reads registry credentials from PLAYGROUND_DOCKER_CONFIG,
+// a docker config.json or legacy .dockercfg, and from
+// PLAYGROUND_REGISTRY_USER/PASS for the default registry.
+func loadAuths() {
+	auths = make(map[string]dcli.AuthConfiguration)
+
+	if path := os.Getenv("PLAYGROUND_DOCKER_CONFIG"); len(path) > 0 {
+		if err := loadDockerConfig(path); err != nil {
+			log.Errorf("Error loading docker config %s: %v", path, err)
+		}
+	}
+
+	user := os.Getenv("PLAYGROUND_REGISTRY_USER")
+	pass := os.Getenv("PLAYGROUND_REGISTRY_PASS")
+
+	if len(user) > 0 {
+		host := registryHost(registry())
+		auths[host] = dcli.AuthConfiguration{
+			Username:      user,
+			Password:      pass,
+			Email:         os.Getenv("PLAYGROUND_REGISTRY_EMAIL"),
+			ServerAddress: host,
+		}
+	}
+}
+
+func loadDockerConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return err
+	}
+
+	// fallback to the legacy .dockercfg format
+	if config.Auths == nil {
+		if err := json.Unmarshal(b, &config.Auths); err != nil {
+			return err
+		}
+	}
+
+	for server, a := range config.Auths {
+		user, pass := a.Username, a.Password
+		if len(a.Auth) > 0 {
+			b, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return err
+			}
+			parts := strings.SplitN(string(b), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			user, pass = parts[0], parts[1]
+		}
+
+		host := normalizeHost(server)
+		auths[host] = dcli.AuthConfiguration{
+			Username:      user,
+			Password:      pass,
+			Email:         a.Email,
+			ServerAddress: server,
+		}
+	}
+
+	return nil
+}
+
+// normalizeHost strips the scheme and path from a registry address
+func normalizeHost(server string) string {
+	if strings.HasPrefix(server, "https://index.docker.io") {
+		return dockerHub
+	}
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	return strings.SplitN(server, "/", 2)[0]
+}
+
+// registryHost returns the registry host for an image reference
+func registryHost(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return dockerHub
+	}
+	if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+		return parts[0]
+	}
+	return dockerHub
+}
+
+// authFor returns the credentials for the registry of an image
+func authFor(image string) dcli.AuthConfiguration {
+	authOnce.Do(loadAuths)
+	return auths[registryHost(image)]
+}
+
+// authConfigs returns all known credentials, used for pulling base images during builds
+func authConfigs() dcli.AuthConfigurations {
+	authOnce.Do(loadAuths)
+	configs := dcli.AuthConfigurations{Configs: make(map[string]dcli.AuthConfiguration)}
+	for host, auth := range auths {
+		configs.Configs[host] = auth
+	}
+	return configs
+}
+
+// Private returns true if an image can only be pulled with the
+// credentials configured for its registry. Public images on a
+// registry with credentials, such as Docker Hub, are not private.
+func Private(image string) bool {
+	authOnce.Do(loadAuths)
+	if _, ok := auths[registryHost(image)]; !ok {
+		return false
+	}
+
+	privateMtx.Lock()
+	c, ok := private[image]
+	privateMtx.Unlock()
+	if ok && time.Since(c.checked) < privateTTL {
+		return c.private
+	}
+
+	p := needsAuth(image)
+
+	privateMtx.Lock()
+	private[image] = &privateCheck{p, time.Now()}
+	privateMtx.Unlock()
+
+	return p
+}
+
+// registryAPI returns the registry v2 api url of an image repository
+func registryAPI(image string) string {
+	host := registryHost(image)
+	name := strings.TrimPrefix(image, host+"/")
+
+	switch host {
+	case dockerHub, "docker.io", "index.docker.io":
+		host = dockerHubAPI
+		// official images live under library
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+
+	scheme := "https"
+	if strings.HasPrefix(host, "localhost") || os.Getenv("PLAYGROUND_REGISTRY_INSECURE") == "true" {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s", scheme, host, name)
+}
+
+// needsAuth returns true unless the registry serves the manifest of
+// an image anonymously, with an anonymous token for registries which
+// require one. Images which can't be checked are taken as private.
+func needsAuth(image string) bool {
+	repo, tag := SplitImage(image)
+	url := registryAPI(repo) + "/manifests/" + tag
+
+	head := func(token string) (*http.Response, error) {
+		req, err := http.NewRequest("HEAD", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rsp, err := registryClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		rsp.Body.Close()
+		return rsp, nil
+	}
+
+	rsp, err := head("")
+	if err != nil {
+		return true
+	}
+	if rsp.StatusCode == http.StatusOK {
+		return false
+	}
+	if rsp.StatusCode != http.StatusUnauthorized {
+		return true
+	}
+
+	token, err := anonymousToken(rsp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return true
+	}
+
+	rsp, err = head(token)
+	return err != nil || rsp.StatusCode != http.StatusOK
+}
+
+// anonymousToken requests a token without credentials from the realm
+// of a bearer challenge
+func anonymousToken(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("Unsupported auth challenge %s", challenge)
+	}
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	realm, err := neturl.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return "", fmt.Errorf("Invalid auth realm %s", params["realm"])
+	}
+
+	// the realm comes from the registry, only follow it over https
+	if realm.Scheme != "https" {
+		return "", fmt.Errorf("Refusing insecure auth realm %s", params["realm"])
+	}
+
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if v, ok := params[k]; ok {
+			q.Set(k, v)
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	rsp, err := registryClient.Get(realm.String())
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error getting token: %s", rsp.Status)
+	}
+
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+	if len(t.Token) > 0 {
+		return t.Token, nil
+	}
+	return t.AccessToken, nil
+}
+
+// ImageFor returns the image name for an app in a target registry and
+// repository. Blank values fall back to the default registry.
+func ImageFor(reg, repo, name string) string {
+	if len(reg) == 0 && len(repo) == 0 {
+		return Image(name)
+	}
+	if len(reg) == 0 {
+		reg = registryHost(registry())
+	}
+	if len(repo) == 0 {
+		repo = repository
+	}
+	return strings.Join([]string{reg, repo, name}, "/")
+}
+
+// Local returns true if an image is in the registry of the server
+func Local(image string) bool {
+	return registryHost(image) == registryHost(registry())
+}
+
+// SplitImage splits an image reference into repository and tag.
+// For a digest reference, repo@sha256:..., the tag is the digest.
+func SplitImage(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+// Reference joins a repository and a tag or digest into an image reference
+func Reference(image, tag string) string {
+	if strings.Contains(tag, ":") {
+		return image + "@" + tag
+	}
+	return image + ":" + tag
+}
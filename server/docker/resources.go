@@ -0,0 +1,57 @@
+package docker
+
+import (
+	dcli "github.com/fsouza/go-dockerclient"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+var (
+	// cpu shares of a single core
+	coreShares int64 = 1024
+	// cfs period limits are enforced over
+	cpuPeriod int64 = 100000
+)
+
+// setResources maps requests to cpu shares and a memory reservation,
+// and limits to a cpu quota and hard memory limit. Quantities are
+// validated by the app so parse errors are ignored.
+func setResources(hc *dcli.HostConfig, r *runtime.Resources) {
+	if r == nil {
+		return
+	}
+
+	if cpu, _ := runtime.ParseCPU(r.Requests.CPU); cpu > 0 {
+		hc.CPUShares = cpu * coreShares / 1000
+	}
+
+	if mem, _ := runtime.ParseMemory(r.Requests.Memory); mem > 0 {
+		hc.MemoryReservation = mem
+	}
+
+	if cpu, _ := runtime.ParseCPU(r.Limits.CPU); cpu > 0 {
+		hc.CPUPeriod = cpuPeriod
+		hc.CPUQuota = cpu * cpuPeriod / 1000
+	}
+
+	if mem, _ := runtime.ParseMemory(r.Limits.Memory); mem > 0 {
+		hc.Memory = mem
+	}
+}
+
+// resourcesFromHost returns the resources a container was given
+func resourcesFromHost(hc *dcli.HostConfig) *runtime.Resources {
+	r := &runtime.Resources{}
+	if hc == nil {
+		return r
+	}
+
+	r.Requests.CPU = runtime.FormatCPU(hc.CPUShares * 1000 / coreShares)
+	r.Requests.Memory = runtime.FormatMemory(hc.MemoryReservation)
+
+	if hc.CPUPeriod > 0 {
+		r.Limits.CPU = runtime.FormatCPU(hc.CPUQuota * 1000 / hc.CPUPeriod)
+	}
+	r.Limits.Memory = runtime.FormatMemory(hc.Memory)
+
+	return r
+}
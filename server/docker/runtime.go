@@ -0,0 +1,435 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dcli "github.com/fsouza/go-dockerclient"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+type dockerRuntime struct {
+	sync.RWMutex
+	monitors map[string]*monitor
+	// containers being removed, whose exit is expected
+	removing map[string]bool
+}
+
+var (
+	appLabel    = "playground.app"
+	healthLabel = "playground.healthcheck"
+
+	// how long the exit of a removed container is ignored for
+	removalGrace = time.Minute
+)
+
+// NewRuntime returns a runtime which runs apps as containers
+// on the docker host, for use without kubernetes
+func NewRuntime() runtime.Runtime {
+	return &dockerRuntime{
+		monitors: make(map[string]*monitor),
+		removing: make(map[string]bool),
+	}
+}
+
+// removeContainer force removes a container of an app, marking it
+// so the watcher doesn't report its exit as a failure
+func (d *dockerRuntime) removeContainer(client *dcli.Client, id string) error {
+	d.Lock()
+	d.removing[id] = true
+	d.Unlock()
+
+	// events of the removal arrive after it returns
+	defer time.AfterFunc(removalGrace, func() {
+		d.Lock()
+		delete(d.removing, id)
+		d.Unlock()
+	})
+
+	return client.RemoveContainer(dcli.RemoveContainerOptions{ID: id, Force: true})
+}
+
+func (d *dockerRuntime) isRemoving(id string) bool {
+	d.RLock()
+	defer d.RUnlock()
+	return d.removing[id]
+}
+
+func containerName(name string, i int) string {
+	return fmt.Sprintf("playground-%s-%d", name, i)
+}
+
+// containers returns the containers of an app
+func containers(client *dcli.Client, name string) ([]dcli.APIContainers, error) {
+	return client.ListContainers(dcli.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {appLabel + "=" + name}},
+	})
+}
+
+// ports returns the ports of an app, the primary port alone if none are set
+func ports(config *runtime.ContainerConfig) []runtime.Port {
+	if len(config.Ports) > 0 {
+		return config.Ports
+	}
+	return []runtime.Port{{
+		Name:          "http",
+		ContainerPort: config.ContainerPort,
+		Protocol:      runtime.ProtocolHTTP,
+		Public:        true,
+	}}
+}
+
+func env(vars map[string]string) []string {
+	var list []string
+	for _, k := range runtime.EnvKeys(vars) {
+		list = append(list, k+"="+vars[k])
+	}
+	return list
+}
+
+func dockerPort(p *runtime.Port) dcli.Port {
+	return dcli.Port(fmt.Sprintf("%d/%s", p.ContainerPort, strings.ToLower(p.Transport())))
+}
+
+// containerOptions returns the docker config for the instances of an app
+func containerOptions(name string, config *runtime.ContainerConfig) (*dcli.Config, *dcli.HostConfig) {
+	labels := map[string]string{appLabel: name}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	if config.HealthCheck != nil {
+		labels[healthLabel] = "true"
+	}
+
+	exposed := make(map[dcli.Port]struct{})
+	bindings := make(map[dcli.Port][]dcli.PortBinding)
+
+	for _, p := range ports(config) {
+		port := dockerPort(&p)
+		exposed[port] = struct{}{}
+
+		// public ports are bound to a random host port
+		if p.Public {
+			bindings[port] = []dcli.PortBinding{{HostIP: "0.0.0.0"}}
+		}
+	}
+
+	containerConfig := &dcli.Config{
+		Image:        config.Image,
+		Env:          env(config.Env),
+		Labels:       labels,
+		ExposedPorts: exposed,
+	}
+
+	hostConfig := &dcli.HostConfig{
+		PortBindings:  bindings,
+		RestartPolicy: dcli.AlwaysRestart(),
+	}
+	setResources(hostConfig, config.Resources)
+
+	return containerConfig, hostConfig
+}
+
+func startInstance(client *dcli.Client, name string, i int, config *dcli.Config, hostConfig *dcli.HostConfig) (*dcli.Container, error) {
+	container, err := client.CreateContainer(dcli.CreateContainerOptions{
+		Name:   containerName(name, i),
+		Config: config,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.StartContainer(container.ID, hostConfig); err != nil {
+		return nil, err
+	}
+
+	return client.InspectContainer(container.ID)
+}
+
+func (d *dockerRuntime) Create(name string, config *runtime.ContainerConfig) (*runtime.Service, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.NumInstances == 0 {
+		config.NumInstances = 1
+	}
+
+	image, tag := SplitImage(config.Image)
+	if !Exists(image, tag) {
+		if err := Pull(image, tag, ioutil.Discard); err != nil {
+			return nil, err
+		}
+	}
+
+	containerConfig, hostConfig := containerOptions(name, config)
+
+	// volumes are kept across redeploys, only created the first time
+	binds, err := createVolumes(client, name, config.Volumes)
+	if err != nil {
+		return nil, err
+	}
+	hostConfig.Binds = binds
+
+	var service *runtime.Service
+
+	for i := 0; i < config.NumInstances; i++ {
+		info, err := startInstance(client, name, i, containerConfig, hostConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if service != nil {
+			continue
+		}
+
+		// the first instance is the address of the service
+		service = &runtime.Service{
+			Name:   name,
+			IP:     info.NetworkSettings.IPAddress,
+			Port:   config.ContainerPort,
+			Status: "Pending",
+		}
+
+		for _, p := range ports(config) {
+			sp := runtime.ServicePort{
+				Name:     p.Name,
+				Port:     p.ContainerPort,
+				Protocol: p.Protocol,
+				Public:   p.Public,
+			}
+			if b := info.NetworkSettings.Ports[dockerPort(&p)]; len(b) > 0 {
+				sp.HostPort, _ = strconv.Atoi(b[0].HostPort)
+			}
+			service.Ports = append(service.Ports, sp)
+		}
+	}
+
+	if config.HealthCheck != nil {
+		d.watch(name, config.HealthCheck, config.ContainerPort)
+	}
+
+	return service, nil
+}
+
+// Scale adds instances cloned from the first or removes the last
+func (d *dockerRuntime) Scale(name string, replicas int) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	list, err := containers(client, name)
+	if err != nil {
+		return err
+	}
+
+	// apps scaled to zero have nothing left to clone
+	if len(list) == 0 {
+		if replicas == 0 {
+			return nil
+		}
+		return runtime.ErrNoInstances
+	}
+
+	sort.Sort(byInstance(list))
+
+	// remove from the end
+	for i := len(list) - 1; i >= replicas; i-- {
+		if err := d.removeContainer(client, list[i].ID); err != nil {
+			return err
+		}
+	}
+
+	if replicas <= len(list) {
+		return nil
+	}
+
+	info, err := client.InspectContainer(list[0].ID)
+	if err != nil {
+		return err
+	}
+
+	next := instanceIndex(list[len(list)-1]) + 1
+	for i := len(list); i < replicas; i++ {
+		if _, err := startInstance(client, name, next, info.Config, info.HostConfig); err != nil {
+			return err
+		}
+		next++
+	}
+
+	return nil
+}
+
+func instanceIndex(c dcli.APIContainers) int {
+	name := instanceName(c)
+	i, _ := strconv.Atoi(name[strings.LastIndex(name, "-")+1:])
+	return i
+}
+
+type byInstance []dcli.APIContainers
+
+func (b byInstance) Len() int           { return len(b) }
+func (b byInstance) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byInstance) Less(i, j int) bool { return instanceIndex(b[i]) < instanceIndex(b[j]) }
+
+// Update replaces the containers of an app
+func (d *dockerRuntime) Update(name string, config *runtime.ContainerConfig, out io.Writer) error {
+	if err := d.Delete(name); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Replacing containers for %s\n", name)
+	_, err := d.Create(name, config)
+	return err
+}
+
+func (d *dockerRuntime) Delete(name string) error {
+	d.unwatch(name)
+
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	list, err := containers(client, name)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range list {
+		if err := d.removeContainer(client, c.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Error removing containers: %v", errs)
+	}
+
+	return nil
+}
+
+// Logs writes the logs of an app's containers, prefixing lines
+// with the container name when more than one is read
+func (d *dockerRuntime) Logs(name string, opts *runtime.LogOptions, out io.Writer) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	if opts == nil {
+		opts = &runtime.LogOptions{}
+	}
+
+	list, err := containers(client, name)
+	if err != nil {
+		return err
+	}
+
+	var selected []dcli.APIContainers
+	for _, c := range list {
+		if len(opts.Instance) == 0 || instanceName(c) == opts.Instance {
+			selected = append(selected, c)
+		}
+	}
+
+	if len(selected) == 0 {
+		return errors.New("No containers running")
+	}
+
+	ids := make(map[string]string)
+	var names []string
+	for _, c := range selected {
+		ids[instanceName(c)] = c.ID
+		names = append(names, instanceName(c))
+	}
+
+	return runtime.Aggregate(names, opts.Follow, out, func(instance string, w io.Writer) error {
+		return containerLogs(client, ids[instance], opts, w)
+	})
+}
+
+// containerLogs reads the logs of a container. Docker keeps the logs
+// of a restarted container so previous runs are always included.
+func containerLogs(client *dcli.Client, id string, opts *runtime.LogOptions, out io.Writer) error {
+	tail := "all"
+	if opts.Tail > 0 {
+		tail = strconv.Itoa(opts.Tail)
+	}
+
+	var since int64
+	if !opts.Since.IsZero() {
+		since = opts.Since.Unix()
+	}
+
+	return client.Logs(dcli.LogsOptions{
+		Container:    id,
+		OutputStream: out,
+		ErrorStream:  out,
+		Stdout:       true,
+		Stderr:       true,
+		Follow:       opts.Follow,
+		Tail:         tail,
+		Since:        since,
+		Timestamps:   opts.Timestamps,
+	})
+}
+
+func instanceName(c dcli.APIContainers) string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// Instances lists the containers of an app
+func (d *dockerRuntime) Instances(name string) ([]*runtime.Instance, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := containers(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	host := client.Endpoint()
+
+	var instances []*runtime.Instance
+	for _, c := range list {
+		info, err := client.InspectContainer(c.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		phase := "Stopped"
+		if info.State.Running {
+			phase = "Running"
+		}
+
+		instances = append(instances, &runtime.Instance{
+			Name:      instanceName(c),
+			Host:      host,
+			IP:        info.NetworkSettings.IPAddress,
+			Phase:     phase,
+			Ready:     info.State.Running,
+			Restarts:  info.RestartCount,
+			Started:   info.State.StartedAt,
+			Image:     info.Config.Image,
+			Resources: resourcesFromHost(info.HostConfig),
+		})
+	}
+
+	return instances, nil
+}
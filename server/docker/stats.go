@@ -0,0 +1,65 @@
+package docker
+
+import (
+	dcli "github.com/fsouza/go-dockerclient"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+// Usage returns the average CPU utilisation of an app's running containers
+func (d *dockerRuntime) Usage(name string) (*runtime.Usage, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := containers(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &runtime.Usage{}
+	var total float64
+
+	for _, c := range list {
+		stats, err := containerStats(client, c.ID)
+		if err != nil {
+			continue
+		}
+
+		cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+		sysDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+		if sysDelta <= 0 {
+			continue
+		}
+
+		cpus := float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+		total += cpuDelta / sysDelta * cpus * 100
+		usage.Instances++
+	}
+
+	if usage.Instances > 0 {
+		usage.CPU = total / float64(usage.Instances)
+	}
+
+	return usage, nil
+}
+
+// containerStats reads a single stats sample
+func containerStats(client *dcli.Client, id string) (*dcli.Stats, error) {
+	ch := make(chan *dcli.Stats, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- client.Stats(dcli.StatsOptions{
+			ID:     id,
+			Stats:  ch,
+			Stream: false,
+		})
+	}()
+
+	stats, ok := <-ch
+	if !ok {
+		return nil, <-errCh
+	}
+	return stats, nil
+}
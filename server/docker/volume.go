@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/myodc/playground-server/server/runtime"
+	dcli "github.com/fsouza/go-dockerclient"
+)
+
+func volumeName(name string, vol *runtime.Volume) string {
+	return fmt.Sprintf("playground-%s-%s", name, vol.Name)
+}
+
+// createVolumes creates the named volumes of an app if they don't
+// exist and returns the binds to mount them. The local driver has
+// no size limit so the requested size is not enforced.
+func createVolumes(client *dcli.Client, name string, volumes []runtime.Volume) ([]string, error) {
+	var binds []string
+
+	for _, vol := range volumes {
+		vname := volumeName(name, &vol)
+
+		if _, err := client.InspectVolume(vname); err == dcli.ErrNoSuchVolume {
+			_, err := client.CreateVolume(dcli.CreateVolumeOptions{
+				Name:   vname,
+				Labels: map[string]string{appLabel: name},
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		binds = append(binds, vname+":"+vol.MountPath)
+	}
+
+	return binds, nil
+}
+
+// DeleteVolumes removes the named volumes of an app
+func (d *dockerRuntime) DeleteVolumes(name string) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	volumes, err := client.ListVolumes(dcli.ListVolumesOptions{
+		Filters: map[string][]string{"label": {appLabel + "=" + name}},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, vol := range volumes {
+		if err := client.RemoveVolume(vol.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+
+	dcli "github.com/fsouza/go-dockerclient"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+// Watch maps docker events of app containers to app states
+func (d *dockerRuntime) Watch(ch chan<- *runtime.StateChange, exit <-chan bool) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	events := make(chan *dcli.APIEvents, 10)
+	if err := client.AddEventListener(events); err != nil {
+		return err
+	}
+	defer client.RemoveEventListener(events)
+
+	for {
+		select {
+		case <-exit:
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return errors.New("Docker event stream closed")
+			}
+			if change := d.containerState(client, e); change != nil {
+				ch <- change
+			}
+		}
+	}
+}
+
+func (d *dockerRuntime) containerState(client *dcli.Client, e *dcli.APIEvents) *runtime.StateChange {
+	switch e.Status {
+	case "create", "start", "die", "oom":
+	default:
+		return nil
+	}
+
+	// containers removed by scaling down or deleting the app
+	if e.Status == "die" && d.isRemoving(e.ID) {
+		return nil
+	}
+
+	info, err := client.InspectContainer(e.ID)
+	if err != nil {
+		return nil
+	}
+
+	name, ok := info.Config.Labels[appLabel]
+	if !ok {
+		return nil
+	}
+
+	change := &runtime.StateChange{
+		Name:   name,
+		Reason: "Container " + e.Status,
+	}
+
+	switch {
+	case e.Status == "oom" || info.State.OOMKilled:
+		change.State = runtime.StateOOMKilled
+		change.Message = fmt.Sprintf("Container %s ran out of memory", info.Name)
+	case e.Status == "create":
+		change.State = runtime.StatePending
+		change.Message = fmt.Sprintf("Container %s created", info.Name)
+	case e.Status == "die" && info.RestartCount > 0:
+		change.State = runtime.StateCrashLooping
+		change.Message = fmt.Sprintf("Container %s exited %d, restarted %d times", info.Name, info.State.ExitCode, info.RestartCount)
+	case e.Status == "die":
+		change.State = runtime.StateFailed
+		change.Message = fmt.Sprintf("Container %s exited %d", info.Name, info.State.ExitCode)
+	case e.Status == "start":
+		// apps with health checks are moved to running by them
+		if info.Config.Labels[healthLabel] == "true" {
+			return nil
+		}
+		change.State = runtime.StateRunning
+		change.Message = fmt.Sprintf("Container %s started", info.Name)
+	}
+
+	return change
+}
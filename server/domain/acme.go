@@ -0,0 +1,286 @@
+package domain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/store"
+	log "github.com/cihub/seelog"
+	"golang.org/x/crypto/acme"
+)
+
+var (
+	acmeNamespace      = "playground:acme"
+	challengeNamespace = "playground:acme:challenges"
+
+	// path http-01 challenges are served on
+	ACMEChallengePath = "/.well-known/acme-challenge/"
+
+	// certificates expiring within this are renewed
+	renewBefore = 30 * 24 * time.Hour
+
+	acmeMtx    sync.Mutex
+	acmeClient *acme.Client
+)
+
+// directory is the ACME directory, PLAYGROUND_ACME_DIRECTORY may
+// point at a local stand-in such as pebble for testing
+func directory() string {
+	if dir := os.Getenv("PLAYGROUND_ACME_DIRECTORY"); len(dir) > 0 {
+		return dir
+	}
+	return acme.LetsEncryptURL
+}
+
+// httpClient trusts PLAYGROUND_ACME_CA in addition to the system
+// roots, needed for stand-ins with self signed certificates
+func httpClient() (*http.Client, error) {
+	path := os.Getenv("PLAYGROUND_ACME_CA")
+	if len(path) == 0 {
+		return http.DefaultClient, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("No certificates found in %s", path)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
+
+// accountKey loads the ACME account key from the store or generates one
+func accountKey() (*ecdsa.PrivateKey, error) {
+	b, err := store.Get(acmeNamespace, "account")
+	if err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, errors.New("Invalid account key")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if err != store.ErrNotFound {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := store.Put(acmeNamespace, "account", b); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func getClient(ctx context.Context) (*acme.Client, error) {
+	acmeMtx.Lock()
+	defer acmeMtx.Unlock()
+
+	if acmeClient != nil {
+		return acmeClient, nil
+	}
+
+	key, err := accountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	hc, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: directory(),
+		HTTPClient:   hc,
+	}
+
+	var contact []string
+	if email := os.Getenv("PLAYGROUND_ACME_EMAIL"); len(email) > 0 {
+		contact = append(contact, "mailto:"+email)
+	}
+
+	_, err = client.Register(ctx, &acme.Account{Contact: contact}, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, err
+	}
+
+	acmeClient = client
+	return client, nil
+}
+
+// Issue obtains a certificate for a verified domain using the http-01
+// challenge, which the routing layer answers with ACMEChallenge
+func Issue(host string) (*Domain, error) {
+	d, err := Read(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.Verified {
+		return nil, fmt.Errorf("Domain not verified")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	client, err := getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(d.Host))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, url := range order.AuthzURLs {
+		if err := authorize(ctx, client, url); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{d.Host},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return setCert(d.Host, certPEM, keyPEM, IssuerACME)
+}
+
+func authorize(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return errors.New("No http-01 challenge offered")
+	}
+
+	response, err := client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return err
+	}
+
+	// stored so any server behind the routing layer can answer
+	if err := store.Put(challengeNamespace, chal.Token, []byte(response)); err != nil {
+		return err
+	}
+	defer store.Del(challengeNamespace, chal.Token)
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return err
+	}
+
+	_, err = client.WaitAuthorization(ctx, url)
+	return err
+}
+
+// ACMEChallenge returns the response for a http-01 challenge token
+func ACMEChallenge(token string) (string, bool) {
+	b, err := store.Get(challengeNamespace, token)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// Renew reissues ACME certificates close to expiry. Blocking.
+func Renew(interval time.Duration) {
+	if enabled, _ := strconv.ParseBool(os.Getenv("PLAYGROUND_ACME")); !enabled {
+		return
+	}
+
+	for {
+		domains, err := List("")
+		if err != nil {
+			log.Errorf("Error listing domains to renew: %v", err)
+		}
+
+		for _, d := range domains {
+			c := d.Certificate
+			if c == nil || c.Issuer != IssuerACME || time.Until(c.NotAfter) > renewBefore {
+				continue
+			}
+			if _, err := Issue(d.Host); err != nil {
+				log.Errorf("Error renewing certificate for %s: %v", d.Host, err)
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,413 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+var storeOnce sync.Once
+
+// testStore points the store at an in memory redis, shared by the
+// tests as the store connects once
+func testStore(t *testing.T) {
+	storeOnce.Do(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("Error starting redis: %v", err)
+		}
+		os.Setenv("PLAYGROUND_REDIS_SERVICE_HOST", s.Host())
+		os.Setenv("PLAYGROUND_REDIS_SERVICE_PORT", s.Port())
+	})
+}
+
+// testACME is a stand-in ACME server for a single order of one
+// domain. Challenges are validated by fetching the key authorization
+// from the challenges server, as a CA would from the domain.
+type testACME struct {
+	*httptest.Server
+
+	challenges string
+	ca         *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+
+	mtx        sync.Mutex
+	nonce      int
+	thumbprint string
+	host       string
+	token      string
+	authz      string
+	order      string
+	cert       []byte
+	validated  bool
+}
+
+func newTestACME(t *testing.T, challenges string) *testACME {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating CA key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Error creating CA: %v", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Error parsing CA: %v", err)
+	}
+
+	a := &testACME{
+		challenges: challenges,
+		ca:         ca,
+		caKey:      caKey,
+		token:      "test-token",
+		authz:      "pending",
+		order:      "pending",
+	}
+	a.Server = httptest.NewTLSServer(http.HandlerFunc(a.serve))
+	return a
+}
+
+// decode returns the protected header and payload of a JWS request
+func decode(r *http.Request) (map[string]json.RawMessage, []byte, error) {
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, nil, err
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, payload, nil
+}
+
+// thumbprint is the RFC 7638 thumbprint of an EC account key
+func thumbprint(raw json.RawMessage) (string, error) {
+	var jwk struct {
+		Crv string `json:"crv"`
+		Kty string `json:"kty"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", err
+	}
+	b := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	sum := sha256.Sum256([]byte(b))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func (a *testACME) orderJSON() map[string]interface{} {
+	o := map[string]interface{}{
+		"status":         a.order,
+		"identifiers":    []map[string]string{{"type": "dns", "value": a.host}},
+		"authorizations": []string{a.URL + "/authz/1"},
+		"finalize":       a.URL + "/finalize/1",
+	}
+	if a.order == "valid" {
+		o["certificate"] = a.URL + "/cert/1"
+	}
+	return o
+}
+
+func (a *testACME) challengeJSON() map[string]interface{} {
+	status := "pending"
+	if a.authz != "pending" {
+		status = a.authz
+	}
+	return map[string]interface{}{
+		"type":   "http-01",
+		"url":    a.URL + "/chal/1",
+		"token":  a.token,
+		"status": status,
+	}
+}
+
+// validate fetches the key authorization for the token from the
+// challenges server
+func (a *testACME) validate() bool {
+	rsp, err := http.Get(a.challenges + ACMEChallengePath + a.token)
+	if err != nil {
+		return false
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return false
+	}
+	return rsp.StatusCode == http.StatusOK && string(b) == a.token+"."+a.thumbprint
+}
+
+func (a *testACME) issue(payload []byte) error {
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return err
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != a.host {
+		return fmt.Errorf("CSR names %v do not match the order", csr.DNSNames)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: a.host},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, tmpl, a.ca, csr.PublicKey, a.caKey)
+	if err != nil {
+		return err
+	}
+
+	a.cert = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.ca.Raw})...)
+	a.order = "valid"
+	return nil
+}
+
+func (a *testACME) serve(w http.ResponseWriter, r *http.Request) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", a.nonce))
+
+	if r.URL.Path == "/directory" {
+		writeTestJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   a.URL + "/nonce",
+			"newAccount": a.URL + "/account",
+			"newOrder":   a.URL + "/order",
+			"revokeCert": a.URL + "/revoke",
+			"keyChange":  a.URL + "/key",
+		})
+		return
+	}
+
+	if r.URL.Path == "/nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	header, payload, err := decode(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/account":
+		if a.thumbprint, err = thumbprint(header["jwk"]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", a.URL+"/account/1")
+		writeTestJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "/order":
+		var req struct {
+			Identifiers []struct {
+				Value string `json:"value"`
+			} `json:"identifiers"`
+		}
+		if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) != 1 {
+			http.Error(w, "Invalid order", http.StatusBadRequest)
+			return
+		}
+		a.host = req.Identifiers[0].Value
+		w.Header().Set("Location", a.URL+"/order/1")
+		writeTestJSON(w, http.StatusCreated, a.orderJSON())
+	case "/order/1":
+		w.Header().Set("Location", a.URL+"/order/1")
+		writeTestJSON(w, http.StatusOK, a.orderJSON())
+	case "/authz/1":
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"status":     a.authz,
+			"identifier": map[string]string{"type": "dns", "value": a.host},
+			"challenges": []interface{}{a.challengeJSON()},
+		})
+	case "/chal/1":
+		a.validated = a.validate()
+		if a.validated {
+			a.authz = "valid"
+			a.order = "ready"
+		} else {
+			a.authz = "invalid"
+			a.order = "invalid"
+		}
+		writeTestJSON(w, http.StatusOK, a.challengeJSON())
+	case "/finalize/1":
+		if a.order != "ready" {
+			http.Error(w, "Order not ready", http.StatusForbidden)
+			return
+		}
+		if err := a.issue(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", a.URL+"/order/1")
+		writeTestJSON(w, http.StatusOK, a.orderJSON())
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(a.cert)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// setupACME starts a stand-in ACME server trusted through
+// PLAYGROUND_ACME_CA and a verified domain to issue for
+func setupACME(t *testing.T, challenges http.Handler) (*testACME, *Domain) {
+	testStore(t)
+
+	cs := httptest.NewServer(challenges)
+	t.Cleanup(cs.Close)
+
+	a := newTestACME(t, cs.URL)
+	t.Cleanup(a.Close)
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, b, 0600); err != nil {
+		t.Fatalf("Error writing CA: %v", err)
+	}
+
+	t.Setenv("PLAYGROUND_ACME_DIRECTORY", a.URL+"/directory")
+	t.Setenv("PLAYGROUND_ACME_CA", ca)
+
+	// register with this stand-in
+	acmeMtx.Lock()
+	acmeClient = nil
+	acmeMtx.Unlock()
+
+	d, err := Add("foo", fmt.Sprintf("foo%d.example.com", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatalf("Error adding domain: %v", err)
+	}
+	d.Verified = true
+	if err := save(d); err != nil {
+		t.Fatalf("Error saving domain: %v", err)
+	}
+
+	return a, d
+}
+
+// answer serves http-01 challenges as the routing layer does
+func answer(w http.ResponseWriter, r *http.Request) {
+	response, ok := ACMEChallenge(strings.TrimPrefix(r.URL.Path, ACMEChallengePath))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprint(w, response)
+}
+
+func TestIssue(t *testing.T) {
+	a, d := setupACME(t, http.HandlerFunc(answer))
+
+	issued, err := Issue(d.Host)
+	if err != nil {
+		t.Fatalf("Error issuing certificate: %v", err)
+	}
+
+	if !a.validated {
+		t.Errorf("Expected the challenge to be answered")
+	}
+
+	if c := issued.Certificate; c == nil || c.Issuer != IssuerACME || c.Subject != d.Host {
+		t.Errorf("Expected an ACME certificate for %s, got %+v", d.Host, c)
+	}
+
+	if _, ok := ACMEChallenge(a.token); ok {
+		t.Errorf("Expected the challenge response to be removed")
+	}
+
+	// served from the store by SNI
+	certMtx.Lock()
+	delete(certs, d.Host)
+	certMtx.Unlock()
+
+	cert, err := GetCertificate(&tls.ClientHelloInfo{ServerName: d.Host})
+	if err != nil {
+		t.Fatalf("Error getting certificate: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname(d.Host); err != nil {
+		t.Errorf("Certificate not valid for %s: %v", d.Host, err)
+	}
+}
+
+func TestIssueChallengeFailed(t *testing.T) {
+	a, d := setupACME(t, http.NotFoundHandler())
+
+	if _, err := Issue(d.Host); err == nil {
+		t.Fatalf("Expected issuing to fail without a challenge response")
+	}
+
+	if a.validated {
+		t.Errorf("Expected the challenge to fail")
+	}
+
+	if d, err := Read(d.Host); err != nil || d.Certificate != nil {
+		t.Errorf("Expected no certificate, got %+v, %v", d, err)
+	}
+}
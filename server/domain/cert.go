@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/store"
+)
+
+const (
+	IssuerUpload = "upload"
+	IssuerACME   = "acme"
+)
+
+// CertInfo describes the certificate of a domain
+type CertInfo struct {
+	Issuer   string
+	Subject  string
+	NotAfter time.Time
+}
+
+// certificate is the stored certificate and private key
+type certificate struct {
+	Host    string
+	CertPEM []byte
+	KeyPEM  []byte
+	Info    *CertInfo
+}
+
+var (
+	certNamespace = "playground:domains:certs"
+
+	certMtx sync.RWMutex
+	certs   = make(map[string]*tls.Certificate)
+)
+
+// parseCert checks the certificate and key match and are valid for the host
+func parseCert(host string, certPEM, keyPEM []byte) (*tls.Certificate, *x509.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := leaf.VerifyHostname(host); err != nil {
+		return nil, nil, err
+	}
+
+	if time.Now().After(leaf.NotAfter) {
+		return nil, nil, fmt.Errorf("Certificate expired on %v", leaf.NotAfter)
+	}
+
+	cert.Leaf = leaf
+	return &cert, leaf, nil
+}
+
+// Upload sets the certificate of a verified domain from PEM encoded data
+func Upload(host string, certPEM, keyPEM []byte) (*Domain, error) {
+	return setCert(host, certPEM, keyPEM, IssuerUpload)
+}
+
+func setCert(host string, certPEM, keyPEM []byte, issuer string) (*Domain, error) {
+	d, err := Read(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.Verified {
+		return nil, fmt.Errorf("Domain not verified")
+	}
+
+	cert, leaf, err := parseCert(d.Host, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &CertInfo{
+		Issuer:   issuer,
+		Subject:  leaf.Subject.CommonName,
+		NotAfter: leaf.NotAfter,
+	}
+
+	b, err := json.Marshal(&certificate{
+		Host:    d.Host,
+		CertPEM: certPEM,
+		KeyPEM:  keyPEM,
+		Info:    info,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.Put(certNamespace, d.Host, b); err != nil {
+		return nil, err
+	}
+
+	certMtx.Lock()
+	certs[d.Host] = cert
+	certMtx.Unlock()
+
+	d.Certificate = info
+	return d, save(d)
+}
+
+func forgetCert(host string) {
+	certMtx.Lock()
+	delete(certs, host)
+	certMtx.Unlock()
+}
+
+// GetCertificate selects the certificate of a custom domain by SNI,
+// for use in a tls.Config
+func GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.ToLower(hello.ServerName)
+	if len(host) == 0 {
+		return nil, fmt.Errorf("No server name")
+	}
+
+	certMtx.RLock()
+	cert, ok := certs[host]
+	certMtx.RUnlock()
+
+	if ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	// load from the store, another server may have issued it
+	b, err := store.Get(certNamespace, host)
+	if err != nil {
+		return nil, fmt.Errorf("No certificate for %s", host)
+	}
+
+	var c *certificate
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	cert, _, err = parseCert(host, c.CertPEM, c.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	certMtx.Lock()
+	certs[host] = cert
+	certMtx.Unlock()
+
+	return cert, nil
+}
@@ -0,0 +1,181 @@
+// Package domain manages custom hostnames for apps, their
+// verification and the certificates they are served with.
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/myodc/playground-server/server/store"
+)
+
+// Domain is a custom hostname routed to an app
+type Domain struct {
+	Host     string
+	AppId    string
+	Token    string
+	Verified bool
+	// Certificate details, the key is never returned
+	Certificate *CertInfo `json:",omitempty"`
+	Created     time.Time
+	Updated     time.Time
+}
+
+var (
+	namespace = "playground:domains"
+	hostRe    = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+)
+
+func genToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// reserved returns true for hostnames of the platform itself: the
+// proxy domain apps are served under, PLAYGROUND_PROXY_DOMAIN, its
+// subdomains and the hostnames of the server.
+func reserved(host string) bool {
+	if proxyDomain := strings.ToLower(os.Getenv("PLAYGROUND_PROXY_DOMAIN")); len(proxyDomain) > 0 {
+		if host == proxyDomain || strings.HasSuffix(host, "."+proxyDomain) {
+			return true
+		}
+	}
+
+	return Server(host)
+}
+
+// Server returns true if host is a hostname of the server itself,
+// PLAYGROUND_HOSTNAME or the machine hostname
+func Server(host string) bool {
+	host = strings.ToLower(host)
+
+	hosts := strings.Split(os.Getenv("PLAYGROUND_HOSTNAME"), ",")
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); len(h) > 0 && host == h {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add registers a hostname for an app. It must be verified before it is served.
+func Add(appId, host string) (*Domain, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !hostRe.MatchString(host) {
+		return nil, fmt.Errorf("Invalid hostname %s", host)
+	}
+
+	if reserved(host) {
+		return nil, fmt.Errorf("Hostname %s is reserved", host)
+	}
+
+	if d, err := Read(host); err == nil {
+		if d.AppId != appId {
+			return nil, fmt.Errorf("Domain already in use")
+		}
+		return d, nil
+	}
+
+	token, err := genToken()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Domain{
+		Host:    host,
+		AppId:   appId,
+		Token:   token,
+		Created: time.Now(),
+	}
+
+	return d, save(d)
+}
+
+func save(d *Domain) error {
+	d.Updated = time.Now()
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return store.Put(namespace, d.Host, b)
+}
+
+func Read(host string) (*Domain, error) {
+	b, err := store.Get(namespace, strings.ToLower(host))
+	if err != nil {
+		return nil, err
+	}
+	var d *Domain
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// List returns the domains of an app, or all domains for a blank id
+func List(appId string) ([]*Domain, error) {
+	results, err := store.Range(namespace, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []*Domain
+	for _, result := range results {
+		var d *Domain
+		if err := json.Unmarshal(result, &d); err != nil {
+			return nil, err
+		}
+		if len(appId) > 0 && d.AppId != appId {
+			continue
+		}
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+// Delete removes a domain and its certificate
+func Delete(host string) error {
+	host = strings.ToLower(host)
+	forgetCert(host)
+	if err := store.Del(certNamespace, host); err != nil {
+		return err
+	}
+	return store.Del(namespace, host)
+}
+
+// DeleteApp removes all domains of an app
+func DeleteApp(appId string) error {
+	domains, err := List(appId)
+	if err != nil {
+		return err
+	}
+	for _, d := range domains {
+		if err := Delete(d.Host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the app a verified hostname routes to
+func Lookup(host string) (string, bool) {
+	d, err := Read(host)
+	if err != nil || !d.Verified {
+		return "", false
+	}
+	return d.AppId, true
+}
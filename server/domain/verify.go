@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// TXT record checked for the verification token
+	txtPrefix = "_playground-challenge."
+	// path the routing layer serves the verification token on
+	ChallengePath = "/.well-known/playground-challenge/"
+)
+
+// Verify checks the domain's token is published in a TXT record at
+// _playground-challenge.<host> or served at ChallengePath on the host,
+// which is the case once the host points at the routing layer.
+func Verify(host string) (*Domain, error) {
+	d, err := Read(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Verified {
+		return d, nil
+	}
+
+	// the host may have become reserved since it was added
+	if reserved(d.Host) {
+		return nil, fmt.Errorf("Hostname %s is reserved", d.Host)
+	}
+
+	if !verifyTXT(d) && !verifyHTTP(d) {
+		return nil, fmt.Errorf("Verification token not found in TXT record %s%s or at http://%s%s%s",
+			txtPrefix, d.Host, d.Host, ChallengePath, d.Token)
+	}
+
+	d.Verified = true
+	return d, save(d)
+}
+
+func verifyTXT(d *Domain) bool {
+	records, err := net.LookupTXT(txtPrefix + d.Host)
+	if err != nil {
+		return false
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == d.Token {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyHTTP(d *Domain) bool {
+	c := &http.Client{Timeout: 10 * time.Second}
+	rsp, err := c.Get("http://" + d.Host + ChallengePath + d.Token)
+	if err != nil {
+		return false
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(b)) == d.Token
+}
+
+// Challenge returns the token to serve for a verification request.
+// Only domains still being verified are answered, never reserved
+// hostnames or hosts already routed to an app.
+func Challenge(host, token string) (string, bool) {
+	d, err := Read(host)
+	if err != nil || d.Verified || d.Token != token || reserved(d.Host) {
+		return "", false
+	}
+	return d.Token, true
+}
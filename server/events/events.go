@@ -13,7 +13,9 @@ import (
 
 const (
 	Error   = "error"
+	Log     = "log"
 	Message = "message"
+	Scale   = "scale"
 	Status  = "status"
 )
 
@@ -133,17 +135,26 @@ func (s *Streamer) Send(topic string, event Event) {
 	c.Do("PUBLISH", "topics:"+topic, b)
 }
 
-func Receive(topic string, stream io.Reader) {
+func receive(topic, typ string, stream io.Reader) {
 	scanner := bufio.NewScanner(stream)
 	for scanner.Scan() {
 		text := scanner.Text()
-		streamer.Send(topic, Event{Id: topic, Body: text, Type: Message})
+		streamer.Send(topic, Event{Id: topic, Body: text, Type: typ})
 	}
 	if err := scanner.Err(); err != nil {
 		return
 	}
 }
 
+func Receive(topic string, stream io.Reader) {
+	receive(topic, Message, stream)
+}
+
+// ReceiveLogs sends each line of app logs as a log event
+func ReceiveLogs(topic string, stream io.Reader) {
+	receive(topic, Log, stream)
+}
+
 func Send(topic string, event Event) {
 	streamer.Send(topic, event)
 }
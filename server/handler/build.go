@@ -74,5 +74,10 @@ func Build(w http.ResponseWriter, r *http.Request) {
 		deploy = false
 	}
 
+	if err := a.Can(app.StatusBuilding); err != nil {
+		writeError(w, err)
+		return
+	}
+
 	go build(a, deploy)
 }
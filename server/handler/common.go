@@ -3,6 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"io"
+	"net"
 	"net/http"
 
 	"github.com/myodc/playground-server/server/app"
@@ -25,7 +27,7 @@ func getApp(w http.ResponseWriter, r *http.Request) (*app.App, error) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return nil, err
 		}
-		return aapp, nil
+		return aapp.As(actor(r)), nil
 	}
 
 	// create app if it does not exist
@@ -35,10 +37,69 @@ func getApp(w http.ResponseWriter, r *http.Request) (*app.App, error) {
 		return nil, err
 	}
 
-	if err := app.Create(aapp); err != nil {
+	if err := app.Create(aapp.As(actor(r))); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return nil, err
 	}
 
 	return aapp, nil
 }
+
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+// newFlushWriter flushes each write so responses are streamed in chunks
+func newFlushWriter(w http.ResponseWriter) io.Writer {
+	f, _ := w.(http.Flusher)
+	return &flushWriter{w: w, f: f}
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if fw.f != nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
+// actor identifies the caller in the status history of apps, by the
+// X-Playground-Actor header or otherwise the remote address
+func actor(r *http.Request) string {
+	if a := r.Header.Get("X-Playground-Actor"); len(a) > 0 {
+		return a
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "api " + host
+}
+
+// writeError responds with 400 Bad Request to an invalid app or
+// change, 409 Conflict to an action the status of an app does not
+// allow or an update from a stale revision, and 500 to other errors
+func writeError(w http.ResponseWriter, err error) {
+	if _, ok := err.(*app.ValidationError); ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := err.(*app.TransitionError); ok || err == app.ErrConflict || err == app.ErrStaleRevision {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -39,9 +39,9 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.Create(aapp)
+	err = app.Create(aapp.As(actor(r)))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
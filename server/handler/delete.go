@@ -2,14 +2,16 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/myodc/playground-server/server/app"
 	"github.com/myodc/playground-server/server/events"
 )
 
-// Delete removes a app.
+// Delete removes a app. Its volumes are kept unless purge is set.
 /*
 	"id": "foo"
+	"purge": "true" [optional]
 */
 func Delete(w http.ResponseWriter, r *http.Request) {
 	id := r.FormValue("id")
@@ -18,8 +20,13 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	purge, err := strconv.ParseBool(r.FormValue("purge"))
+	if err != nil {
+		purge = false
+	}
+
 	go func() {
-		err := app.Delete(id)
+		err := app.Delete(id, purge)
 		if err != nil {
 			events.Send(id, events.Event{Body: "Error deleting app: " + err.Error(), Type: events.Message})
 			return
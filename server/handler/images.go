@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/docker"
+)
+
+// GC runs image garbage collection. Defaults to a dry run
+// which reports the images that would be removed, removing
+// them requires a POST.
+/*
+	"dry_run": "false" [optional]
+	"keep": 5 [optional]
+*/
+func GC(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := strconv.ParseBool(r.FormValue("dry_run"))
+	if err != nil {
+		dryRun = true
+	}
+
+	if !dryRun && r.Method != "POST" {
+		http.Error(w, "Collecting images requires a POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	policy := docker.DefaultPolicy()
+	if keep, err := strconv.Atoi(r.FormValue("keep")); err == nil && keep > 0 {
+		policy.KeepReleases = keep
+	}
+
+	// releases apps run or roll back to are never collected
+	policy.InUse, err = app.Images()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report, err := docker.GC(policy, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+// Instances returns the replicas of an app.
+/*
+	"id": "foo"
+*/
+func Instances(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
+		return
+	}
+
+	instances, err := app.Instances(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(map[string][]*runtime.Instance{"instances": instances})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
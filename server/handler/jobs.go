@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/store"
+)
+
+// RunJob triggers a run of a job app. The run continues in the
+// background and is returned straight away.
+/*
+	"id": "foo"
+*/
+func RunJob(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
+		return
+	}
+
+	run, err := app.Trigger(id, "manual")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, run)
+}
+
+// Runs returns the run history of a job app, newest first.
+// Logs are only returned when reading a single run.
+/*
+	"id": "foo"
+	"offset": 0 [optional]
+	"limit": 20 [optional]
+*/
+func Runs(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
+		return
+	}
+
+	offset, err := strconv.Atoi(r.FormValue("offset"))
+	if err != nil {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		limit = 20
+	}
+
+	runs, err := app.Runs(id, offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, run := range runs {
+		run.Logs = ""
+	}
+
+	writeJSON(w, map[string][]*app.Run{"runs": runs})
+}
+
+// ReadRun returns a run of a job app including its logs.
+/*
+	"id": "foo"
+	"run": "ih1a2b3c4d"
+*/
+func ReadRun(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	runId := r.FormValue("run")
+	if len(id) == 0 || len(runId) == 0 {
+		http.Error(w, "Require app Id and run", http.StatusBadRequest)
+		return
+	}
+
+	run, err := app.ReadRun(id, runId)
+	if err == store.ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, run)
+}
+
+// KillRun stops an active run of a job app. The run is not retried.
+/*
+	"id": "foo"
+	"run": "ih1a2b3c4d"
+*/
+func KillRun(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	runId := r.FormValue("run")
+	if len(id) == 0 || len(runId) == 0 {
+		http.Error(w, "Require app Id and run", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Kill(id, runId); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,15 +1,36 @@
 package handler
 
 import (
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/events"
+	"github.com/myodc/playground-server/server/runtime"
+	log "github.com/cihub/seelog"
 )
 
-// Logs returns app logs.
+var (
+	// how long followed logs are sent to the event stream
+	maxLogStream = 10 * time.Minute
+)
+
+// Logs returns app logs. Without an instance the logs
+// of all instances are returned, prefixed by instance name.
+// Followed logs are streamed as a chunked response or, with
+// stream set to events, as log events on the app's topic.
 /*
 	"id": "foo"
+	"instance": "foo-x1y2z" [optional]
 	"container": "foo" [optional]
+	"follow": "true" [optional]
+	"tail": 100 [optional]
+	"since": "2015-01-02T15:04:05Z" or "10m" [optional]
+	"timestamps": "true" [optional]
+	"previous": "true" [optional]
+	"stream": "events" [optional]
 */
 
 func Logs(w http.ResponseWriter, r *http.Request) {
@@ -19,10 +40,78 @@ func Logs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	container := r.FormValue("container")
+	opts := &runtime.LogOptions{
+		Instance:  r.FormValue("instance"),
+		Container: r.FormValue("container"),
+	}
+
+	opts.Follow, _ = strconv.ParseBool(r.FormValue("follow"))
+	opts.Timestamps, _ = strconv.ParseBool(r.FormValue("timestamps"))
+	opts.Previous, _ = strconv.ParseBool(r.FormValue("previous"))
+
+	if tail := r.FormValue("tail"); len(tail) > 0 {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid tail", http.StatusBadRequest)
+			return
+		}
+		opts.Tail = n
+	}
+
+	if since := r.FormValue("since"); len(since) > 0 {
+		t, err := parseSince(since)
+		if err != nil {
+			http.Error(w, "Invalid since, require RFC3339 time or duration", http.StatusBadRequest)
+			return
+		}
+		opts.Since = t
+	}
+
+	if r.FormValue("stream") == "events" {
+		go streamLogs(id, opts)
+		return
+	}
+
+	var out io.Writer = w
+	if opts.Follow {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		out = newFlushWriter(w)
+	}
 
-	err := app.Logs(id, container, w)
+	err := app.Logs(id, opts, out)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// streamLogs sends logs to the event stream, followed
+// logs are sent for at most maxLogStream
+func streamLogs(id string, opts *runtime.LogOptions) {
+	in, out := io.Pipe()
+
+	go events.ReceiveLogs(id, in)
+
+	if opts.Follow {
+		t := time.AfterFunc(maxLogStream, func() {
+			in.Close()
+		})
+		defer t.Stop()
+	}
+
+	err := app.Logs(id, opts, out)
+	out.Close()
+
+	if err != nil && err != io.ErrClosedPipe {
+		log.Errorf("Error streaming logs for %s: %v", id, err)
+		events.Send(id, events.Event{Body: "Error streaming logs: " + err.Error(), Type: events.Error})
+	}
+}
+
+func parseSince(since string) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, since)
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/events"
+)
+
+// Apply creates or updates an app from a YAML or JSON manifest,
+// sent as the manifest param or the request body. Nothing changes
+// when the app already matches. The changes are returned and with
+// dry_run set are not made.
+/*
+	"manifest": "kind: App\nversion: v1\nid: foo\n..."
+	"dry_run": "true" [optional]
+	"deploy": "true" [optional]
+*/
+func Apply(w http.ResponseWriter, r *http.Request) {
+	b := []byte(r.FormValue("manifest"))
+	if len(b) == 0 {
+		var err error
+		b, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(b) == 0 {
+		http.Error(w, "Require a manifest", http.StatusBadRequest)
+		return
+	}
+
+	m, err := app.ParseManifest(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+
+	applied, err := app.Apply(m, dryRun)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, applied)
+
+	if dryRun || applied.Action == app.ApplyUnchanged {
+		return
+	}
+
+	events.Send(m.Id, events.Event{Body: "App " + applied.Action + " from manifest", Type: events.Message})
+
+	if deploy, _ := strconv.ParseBool(r.FormValue("deploy")); deploy {
+		go build(applied.App.As(actor(r)), deploy)
+	}
+}
+
+// Export returns the manifest of an app as YAML, or JSON with format set to json.
+/*
+	"id": "foo"
+	"format": "json" [optional]
+*/
+func Export(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
+		return
+	}
+
+	m, err := app.Export(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	format := r.FormValue("format")
+
+	b, err := app.MarshalManifest(m, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/x-yaml")
+	}
+	w.Write(b)
+}
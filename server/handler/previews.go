@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/events"
+	"github.com/myodc/playground-server/server/proxy"
+)
+
+type preview struct {
+	*app.Preview
+	URL string
+}
+
+// pushEvent is the part of a github push webhook used for previews
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+	} `json:"repository"`
+}
+
+// validSignature checks the webhook is signed with PLAYGROUND_WEBHOOK_SECRET
+func validSignature(r *http.Request, body []byte) bool {
+	secret := os.Getenv("PLAYGROUND_WEBHOOK_SECRET")
+	if len(secret) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Hub-Signature-256")))
+}
+
+// PushHook receives git push webhooks. Pushes to branches of apps
+// with previews enabled build and deploy the preview for the branch,
+// deleting a branch removes it.
+func PushHook(w http.ResponseWriter, r *http.Request) {
+	// anyone could trigger builds without a secret to sign with
+	if len(os.Getenv("PLAYGROUND_WEBHOOK_SECRET")) == 0 {
+		http.Error(w, "Webhook secret not configured", http.StatusForbidden)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(r, body) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var ev pushEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// tags are not previewed
+	if !strings.HasPrefix(ev.Ref, "refs/heads/") {
+		return
+	}
+	branch := strings.TrimPrefix(ev.Ref, "refs/heads/")
+	if err := app.ValidBranch(branch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	previews, err := app.Push(ev.Repository.CloneURL, branch, ev.After, ev.Deleted)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, a := range previews {
+		go build(a, true)
+	}
+}
+
+// CreatePreview builds and deploys the preview of an app for a branch
+/*
+	"id": "foo"
+	"branch": "feature/login"
+*/
+func CreatePreview(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	branch := r.FormValue("branch")
+	if len(id) == 0 || len(branch) == 0 {
+		http.Error(w, "Require app Id and branch", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.ValidBranch(branch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a, p, err := app.PreviewBranch(id, branch, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events.Send(id, events.Event{Body: "Deploying preview " + a.Id, Type: events.Message})
+
+	writeJSON(w, &preview{p, proxy.URL(p.AppId)})
+
+	go build(a, true)
+}
+
+// ListPreviews returns the branch previews of an app
+/*
+	"id": "foo"
+*/
+func ListPreviews(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
+		return
+	}
+
+	previews, err := app.Previews(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var list []*preview
+	for _, p := range previews {
+		list = append(list, &preview{p, proxy.URL(p.AppId)})
+	}
+
+	writeJSON(w, map[string][]*preview{"previews": list})
+}
+
+// DeletePreview removes the preview of an app for a branch
+/*
+	"id": "foo"
+	"branch": "feature/login"
+*/
+func DeletePreview(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	branch := r.FormValue("branch")
+	if len(id) == 0 || len(branch) == 0 {
+		http.Error(w, "Require app Id and branch", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.DeletePreview(id, branch); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
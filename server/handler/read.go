@@ -30,6 +30,7 @@ func Read(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, aapp)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(b)
 }
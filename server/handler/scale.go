@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/myodc/playground-server/server/app"
+)
+
+// Scale changes the number of instances of an app.
+/*
+	"id": "foo"
+	"instances": 3
+*/
+func Scale(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
+		return
+	}
+
+	instances, err := strconv.Atoi(r.FormValue("instances"))
+	if err != nil {
+		http.Error(w, "Require number of instances", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Scale(id, instances, "requested"); err != nil {
+		writeError(w, err)
+		return
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/events"
+)
+
+// Catalog returns the backing services which can be provisioned
+func Catalog(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string][]*app.ServiceTemplate{"services": app.Catalog()})
+}
+
+// Provision creates and starts an instance of a catalog service
+/*
+	"service": "postgres"
+	"id": "orders-db"
+	"namespace": "team-a" [optional]
+*/
+func Provision(w http.ResponseWriter, r *http.Request) {
+	service := r.FormValue("service")
+	id := r.FormValue("id")
+	if len(service) == 0 || len(id) == 0 {
+		http.Error(w, "Require service and Id", http.StatusBadRequest)
+		return
+	}
+
+	svc, a, err := app.Provision(service, id, r.FormValue("namespace"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, svc)
+
+	go start(a, false)
+}
+
+// ListServices returns the provisioned service instances
+/*
+	"offset": 0 [optional]
+	"limit": 20 [optional]
+*/
+func ListServices(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.Atoi(r.FormValue("offset"))
+	if err != nil {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		limit = 20
+	}
+
+	services, err := app.ListServices(offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string][]*app.ServiceInstance{"services": services})
+}
+
+// ReadService returns a service instance
+/*
+	"id": "orders-db"
+*/
+func ReadService(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require service Id", http.StatusBadRequest)
+		return
+	}
+
+	svc, err := app.ReadService(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, svc)
+}
+
+// BindService sets the connection details of a service in the env
+// of an app, restarting the app if it is up so they take effect
+/*
+	"id": "orders-db"
+	"app": "web"
+*/
+func BindService(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	appId := r.FormValue("app")
+	if len(id) == 0 || len(appId) == 0 {
+		http.Error(w, "Require service Id and app", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Bind(id, appId); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events.Send(appId, events.Event{Body: "Bound to service " + id, Type: events.Message})
+
+	go reload(appId)
+}
+
+// UnbindService removes a service from the env of an app. The
+// service is deprovisioned when no other app is bound to it.
+/*
+	"id": "orders-db"
+	"app": "web"
+*/
+func UnbindService(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	appId := r.FormValue("app")
+	if len(id) == 0 || len(appId) == 0 {
+		http.Error(w, "Require service Id and app", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Unbind(id, appId); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events.Send(appId, events.Event{Body: "Unbound from service " + id, Type: events.Message})
+
+	go reload(appId)
+}
+
+// Deprovision deletes a service instance which is not bound to any app
+/*
+	"id": "orders-db"
+*/
+func Deprovision(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require service Id", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Deprovision(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func reload(id string) {
+	a, err := app.Read(id)
+	if err != nil {
+		return
+	}
+
+	if err := a.Reload(); err != nil {
+		events.Send(id, events.Event{Body: err.Error(), Type: events.Error})
+	}
+}
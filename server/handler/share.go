@@ -20,10 +20,9 @@ func Share(w http.ResponseWriter, r *http.Request) {
 	lang := r.FormValue("lang")
 	text := r.FormValue("text")
 
-	id := code.GenShortId()
-	err := code.Save(id, &code.Code{Lang: lang, Text: text})
+	id, err := code.Share(&code.Code{Lang: lang, Text: text})
 	if err != nil {
-		log.Errorf("Error saving code %s: %v", id, err)
+		log.Errorf("Error saving code: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
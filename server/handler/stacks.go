@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/events"
+	log "github.com/cihub/seelog"
+)
+
+func getStack(w http.ResponseWriter, r *http.Request) (*app.Stack, bool) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require stack Id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	s, err := app.ReadStack(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return s, true
+}
+
+func decodeStack(w http.ResponseWriter, r *http.Request) (*app.Stack, bool) {
+	st := r.FormValue("stack")
+	if len(st) == 0 {
+		http.Error(w, "Require a stack definition", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var s *app.Stack
+	if err := json.Unmarshal([]byte(st), &s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// CreateStack groups existing apps into a stack
+/*
+	"stack": {
+		"id": "shop",
+		"members": [
+			{"appId": "redis"},
+			{"appId": "web", "dependsOn": ["redis"]},
+			{"appId": "worker", "dependsOn": ["redis"]}
+		]
+	}
+*/
+func CreateStack(w http.ResponseWriter, r *http.Request) {
+	s, ok := decodeStack(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.CreateStack(s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, s)
+}
+
+// UpdateStack replaces the members of a stack. Running apps pick up
+// changed dependencies the next time they are started.
+/*
+	"stack": {...}
+*/
+func UpdateStack(w http.ResponseWriter, r *http.Request) {
+	s, ok := decodeStack(w, r)
+	if !ok {
+		return
+	}
+
+	old, err := app.ReadStack(s.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.Created = old.Created
+
+	if err := app.UpdateStack(s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, s)
+}
+
+// ReadStack returns a stack and the start order of its apps
+/*
+	"id": "shop"
+*/
+func ReadStack(w http.ResponseWriter, r *http.Request) {
+	s, ok := getStack(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := s.Order()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"stack": s,
+		"order": order,
+	})
+}
+
+// ListStacks returns a list of stacks
+/*
+	"offset": 0 [optional]
+	"limit": 20 [optional]
+*/
+func ListStacks(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.Atoi(r.FormValue("offset"))
+	if err != nil {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		limit = 20
+	}
+
+	stacks, err := app.ListStacks(offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string][]*app.Stack{"stacks": stacks})
+}
+
+// DeleteStack removes a stack and its apps. Volumes are kept unless purge is set.
+/*
+	"id": "shop"
+	"purge": "true" [optional]
+*/
+func DeleteStack(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require stack Id", http.StatusBadRequest)
+		return
+	}
+
+	purge, err := strconv.ParseBool(r.FormValue("purge"))
+	if err != nil {
+		purge = false
+	}
+
+	go func() {
+		if err := app.DeleteStack(id, purge); err != nil {
+			events.Send(id, events.Event{Body: "Error deleting stack: " + err.Error(), Type: events.Error})
+			return
+		}
+
+		events.Send(id, events.Event{Body: "Stack deleted", Type: events.Message})
+	}()
+}
+
+// BuildStack builds the apps of a stack in start order
+/*
+	"id": "shop"
+	"deploy": "true" [optional]
+*/
+func BuildStack(w http.ResponseWriter, r *http.Request) {
+	s, ok := getStack(w, r)
+	if !ok {
+		return
+	}
+
+	deploy, err := strconv.ParseBool(r.FormValue("deploy"))
+	if err != nil {
+		deploy = false
+	}
+
+	go func() {
+		log.Infof("Building stack %s", s.Id)
+		if err := s.Build(); err != nil {
+			log.Errorf("Error building stack %s: %v", s.Id, err)
+			events.Send(s.Id, events.Event{Body: "An error occurred during the build: " + err.Error(), Type: events.Error})
+			return
+		}
+
+		events.Send(s.Id, events.Event{Body: "Build complete", Type: events.Message})
+
+		if !deploy {
+			return
+		}
+
+		// restart so running apps pick up their new images
+		if err := s.Stop(); err != nil {
+			events.Send(s.Id, events.Event{Body: err.Error(), Type: events.Error})
+			return
+		}
+
+		startStack(s)
+	}()
+}
+
+func startStack(s *app.Stack) {
+	if err := s.Start(); err != nil {
+		log.Errorf("Error starting stack %s: %v", s.Id, err)
+		events.Send(s.Id, events.Event{Body: err.Error(), Type: events.Error})
+		return
+	}
+
+	events.Send(s.Id, events.Event{Body: "Deploy complete", Type: events.Message})
+}
+
+// StartStack starts the apps of a stack after the apps they depend on
+/*
+	"id": "shop"
+*/
+func StartStack(w http.ResponseWriter, r *http.Request) {
+	s, ok := getStack(w, r)
+	if !ok {
+		return
+	}
+
+	go startStack(s)
+}
+
+// StopStack stops the apps of a stack, dependents first
+/*
+	"id": "shop"
+*/
+func StopStack(w http.ResponseWriter, r *http.Request) {
+	s, ok := getStack(w, r)
+	if !ok {
+		return
+	}
+
+	go func() {
+		if err := s.Stop(); err != nil {
+			events.Send(s.Id, events.Event{Body: err.Error(), Type: events.Error})
+			return
+		}
+
+		events.Send(s.Id, events.Event{Body: "Stop complete", Type: events.Message})
+	}()
+}
@@ -71,5 +71,15 @@ func Start(w http.ResponseWriter, r *http.Request) {
 		build = false
 	}
 
+	next := app.StatusStarting
+	if build {
+		next = app.StatusBuilding
+	}
+
+	if err := a.Can(next); err != nil {
+		writeError(w, err)
+		return
+	}
+
 	go start(a, build)
 }
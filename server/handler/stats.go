@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/proxy"
+)
+
+// Stats returns the requests proxied to an app, or to all apps
+// when no id is given.
+/*
+	"id": "foo" [optional]
+*/
+func Stats(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+
+	if id := r.FormValue("id"); len(id) > 0 {
+		ids = append(ids, id)
+	} else {
+		apps, err := app.List(0, -1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, a := range apps {
+			ids = append(ids, a.Id)
+		}
+	}
+
+	var stats []*proxy.Stats
+	for _, id := range ids {
+		s, err := proxy.AppStats(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats = append(stats, s)
+	}
+
+	b, err := json.Marshal(map[string][]*proxy.Stats{"stats": stats})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -35,5 +35,10 @@ func Stop(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go stop(a)
+	if err := a.Can(app.StatusStopping); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	go stop(a.As(actor(r)))
 }
@@ -2,15 +2,65 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/myodc/playground-server/server/app"
 	"github.com/myodc/playground-server/server/events"
 	log "github.com/cihub/seelog"
 )
 
-// Update modifies a app.
+// deploy builds, pushes and restarts an updated app
+func deploy(a *app.App) {
+	log.Infof("Building code for id: %s", a.Id)
+	if err := a.Build(); err != nil {
+		log.Errorf("Error building image: %v", err)
+		events.Send(a.Id, events.Event{Body: "An error occurred during the build: " + err.Error(), Type: events.Error})
+		return
+	}
+
+	events.Send(a.Id, events.Event{Body: "Build complete", Type: events.Message})
+
+	// push to registry
+	if err := a.Push(); err != nil {
+		log.Errorf("Error pushing image: %v", err)
+		events.Send(a.Id, events.Event{Body: "An error occurred during the push process: " + err.Error(), Type: events.Error})
+		return
+	}
+
+	events.Send(a.Id, events.Event{Body: "Push complete", Type: events.Message})
+
+	if err := a.Restart(); err != nil {
+		events.Send(a.Id, events.Event{Body: err.Error(), Type: events.Error})
+		return
+	}
+
+	events.Send(a.Id, events.Event{Body: "Deploy complete", Type: events.Message})
+}
+
+// revision returns the revision an update is made from, 0 if not given
+func revision(r *http.Request) (int64, error) {
+	rev := r.Header.Get("If-Match")
+	if len(rev) == 0 {
+		rev = r.FormValue("revision")
+	}
+	if len(rev) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(strings.Trim(strings.TrimPrefix(rev, "W/"), `"`), 10, 64)
+}
+
+func setETag(w http.ResponseWriter, a *app.App) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, a.Revision))
+}
+
+// Update replaces a app. The revision it was read at is given by
+// the If-Match header, the revision param or the app's Revision, and
+// the update is refused with 409 Conflict if the app has changed
+// since. Without a revision the app is overwritten.
 /*
 	"app": {
 		"id": "foo",
@@ -24,65 +74,103 @@ import (
 			"GitUrl": "https://github.com/foo/bar.git",
 		}
 	}
+	"revision": 3 [optional]
+	"deploy": "true" [optional]
 */
-func update(a *app.App, deploy bool) {
-	err := app.Update(a)
-	if err != nil {
-		log.Errorf("Error updating app: %v", err)
+func Update(w http.ResponseWriter, r *http.Request) {
+	tsk := r.FormValue("app")
+	if len(tsk) == 0 {
+		http.Error(w, "Require a app definition", http.StatusBadRequest)
 		return
 	}
 
-	events.Send(a.Id, events.Event{Body: "App updated successfully", Type: events.Message})
-
-	if !deploy {
+	var a *app.App
+	err := json.Unmarshal([]byte(tsk), &a)
+	if err != nil || a == nil {
+		http.Error(w, "Invalid app definition", http.StatusBadRequest)
 		return
 	}
 
-	log.Infof("Building code for id: %s", a.Id)
-	if err = a.Build(); err != nil {
-		log.Errorf("Error building image: %v", err)
-		events.Send(a.Id, events.Event{Body: "An error occurred during the build: " + err.Error(), Type: events.Error})
+	rev, err := revision(r)
+	if err != nil {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
 		return
 	}
+	if rev > 0 {
+		a.Revision = rev
+	}
 
-	events.Send(a.Id, events.Event{Body: "Build complete", Type: events.Message})
+	dep, err := strconv.ParseBool(r.FormValue("deploy"))
+	if err != nil {
+		dep = false
+	}
 
-	// push to registry
-	if err := a.Push(); err != nil {
-		log.Errorf("Error pushing image: %v", err)
-		events.Send(a.Id, events.Event{Body: "An error occurred during the push process: " + err.Error(), Type: events.Error})
+	if dep {
+		if err := a.Can(app.StatusBuilding); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	if err := app.Update(a.As(actor(r))); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	events.Send(a.Id, events.Event{Body: "Push complete", Type: events.Message})
+	events.Send(a.Id, events.Event{Body: "App updated successfully", Type: events.Message})
 
-	if err = a.Restart(); err != nil {
-		events.Send(a.Id, events.Event{Body: err.Error(), Type: events.Error})
+	setETag(w, a)
+	writeJSON(w, a)
+
+	if dep {
+		go deploy(a)
+	}
+}
+
+// Patch changes only the fields of a app given in a partial app
+// JSON, sent as the patch param or the request body. The revision
+// is checked as for Update.
+/*
+	"id": "foo"
+	"patch": {"config": {"numInstances": 2}}
+	"revision": 3 [optional]
+*/
+func Patch(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
 		return
 	}
 
-	events.Send(a.Id, events.Event{Body: "Deploy complete", Type: events.Message})
-}
+	patch := []byte(r.FormValue("patch"))
+	if len(patch) == 0 {
+		var err error
+		patch, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-func Update(w http.ResponseWriter, r *http.Request) {
-	// TODO: implement update
-	tsk := r.FormValue("app")
-	if len(tsk) == 0 {
-		http.Error(w, "Require a app definition", http.StatusBadRequest)
+	if len(patch) == 0 {
+		http.Error(w, "Require a patch", http.StatusBadRequest)
 		return
 	}
 
-	var a *app.App
-	err := json.Unmarshal([]byte(tsk), &a)
+	rev, err := revision(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
 		return
 	}
 
-	deploy, err := strconv.ParseBool(r.FormValue("deploy"))
+	a, err := app.Patch(id, patch, rev)
 	if err != nil {
-		deploy = false
+		writeError(w, err)
+		return
 	}
 
-	go update(a, deploy)
+	events.Send(a.Id, events.Event{Body: "App updated successfully", Type: events.Message})
+
+	setETag(w, a)
+	writeJSON(w, a)
 }
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/myodc/playground-server/server/app"
+)
+
+var (
+	// how long a request is held while an app wakes
+	wakeTimeout = 2 * time.Minute
+)
+
+// Wake starts an idle app, holding the request until it is
+// ready. It records a request to the app so proxies can call
+// it on every request to keep the app awake.
+/*
+	"id": "foo"
+*/
+func Wake(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		http.Error(w, "Require app Id", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Wake(id, wakeTimeout); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	status, err := app.Status(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,83 @@
+package kube
+
+import (
+	"context"
+
+	"github.com/myodc/playground-server/server/runtime"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// pods metric served by a custom metrics adapter for request rate targets
+	requestRateMetric = "http_requests_per_second"
+)
+
+// Autoscale creates or updates a horizontal pod autoscaler for an
+// app's deployment. Request rate targets need a custom metrics
+// adapter serving the requests per second of each pod.
+func (k *kubeRuntime) Autoscale(name string, policy *runtime.Autoscale) error {
+	ctx := context.Background()
+	hpas := k.client.AutoscalingV2().HorizontalPodAutoscalers(k.namespace(name))
+
+	min := int32(policy.MinInstances)
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"name": name},
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       name,
+			},
+			MinReplicas: &min,
+			MaxReplicas: int32(policy.MaxInstances),
+		},
+	}
+
+	if policy.TargetCPU > 0 {
+		cpu := int32(policy.TargetCPU)
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &cpu,
+				},
+			},
+		})
+	}
+
+	if policy.TargetRequestRate > 0 {
+		rate := resource.NewMilliQuantity(int64(policy.TargetRequestRate*1000), resource.DecimalSI)
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{Name: requestRateMetric},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: rate,
+				},
+			},
+		})
+	}
+
+	existing, err := hpas.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = hpas.Create(ctx, hpa, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	existing.Spec = hpa.Spec
+	_, err = hpas.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
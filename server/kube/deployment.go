@@ -0,0 +1,352 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	defaultPort = 8080
+	// how long Update waits for a rollout
+	rolloutTimeout = 5 * time.Minute
+)
+
+// withDefaults fills in the primary port and port list. Instances
+// are left as they are, an app may be scaled to zero.
+func withDefaults(name string, config *runtime.ContainerConfig) *runtime.ContainerConfig {
+	if config == nil {
+		config = &runtime.ContainerConfig{}
+	}
+
+	if config.ContainerPort == 0 {
+		config.ContainerPort = defaultPort
+	}
+
+	labels := map[string]string{}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	labels["name"] = name
+	config.Labels = labels
+
+	if len(config.Ports) == 0 {
+		config.Ports = []runtime.Port{{
+			Name:          "http",
+			ContainerPort: config.ContainerPort,
+			Protocol:      runtime.ProtocolHTTP,
+			Public:        true,
+		}}
+	}
+
+	return config
+}
+
+func envVars(env map[string]string) []corev1.EnvVar {
+	var vars []corev1.EnvVar
+	for _, k := range runtime.EnvKeys(env) {
+		vars = append(vars, corev1.EnvVar{Name: k, Value: env[k]})
+	}
+	return vars
+}
+
+// container returns the app container of a pod
+func container(name string, config *runtime.ContainerConfig) corev1.Container {
+	var ports []corev1.ContainerPort
+	for _, p := range config.Ports {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: int32(p.ContainerPort),
+			Protocol:      corev1.Protocol(p.Transport()),
+		})
+	}
+
+	c := corev1.Container{
+		Name:            name,
+		Image:           config.Image,
+		Ports:           ports,
+		Env:             envVars(config.Env),
+		VolumeMounts:    volumeMounts(config.Volumes),
+		Resources:       requirements(config.Resources),
+		ImagePullPolicy: corev1.PullAlways,
+	}
+
+	if hc := config.HealthCheck; hc != nil {
+		c.LivenessProbe = probeFromCheck(hc, config.ContainerPort)
+		c.ReadinessProbe = probeFromCheck(hc, config.ContainerPort)
+	}
+
+	return c
+}
+
+func deploymentFromConfig(name string, config *runtime.ContainerConfig) *appsv1.Deployment {
+	replicas := int32(config.NumInstances)
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: config.Labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"name": name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: config.Labels,
+				},
+				Spec: corev1.PodSpec{
+					Volumes:    volumes(name, config.Volumes),
+					Containers: []corev1.Container{container(name, config)},
+				},
+			},
+		},
+	}
+}
+
+// serviceFromConfig returns a single service for the primary
+// and public ports of an app
+func serviceFromConfig(name string, config *runtime.ContainerConfig) *corev1.Service {
+	var ports []corev1.ServicePort
+	for _, p := range config.Ports {
+		if !p.Public && p.ContainerPort != config.ContainerPort {
+			continue
+		}
+
+		sp := corev1.ServicePort{
+			Name:       p.Name,
+			Port:       int32(p.ContainerPort),
+			TargetPort: intstr.FromInt(p.ContainerPort),
+			Protocol:   corev1.Protocol(p.Transport()),
+		}
+
+		switch p.Protocol {
+		case runtime.ProtocolHTTP, runtime.ProtocolGRPC:
+			proto := strings.ToLower(p.Protocol)
+			sp.AppProtocol = &proto
+		}
+
+		ports = append(ports, sp)
+	}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: config.Labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports:    ports,
+			Selector: map[string]string{"name": name},
+		},
+	}
+}
+
+// applyService creates the service of an app or updates its ports
+func (k *kubeRuntime) applyService(ctx context.Context, namespace, name string, config *runtime.ContainerConfig) (*corev1.Service, error) {
+	services := k.client.CoreV1().Services(namespace)
+	svc := serviceFromConfig(name, config)
+
+	existing, err := services.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return services.Create(ctx, svc, metav1.CreateOptions{})
+	} else if err != nil {
+		return nil, err
+	}
+
+	existing.Labels = svc.Labels
+	existing.Spec.Ports = svc.Spec.Ports
+	existing.Spec.Selector = svc.Spec.Selector
+	return services.Update(ctx, existing, metav1.UpdateOptions{})
+}
+
+func serviceFor(name string, svc *corev1.Service, config *runtime.ContainerConfig) *runtime.Service {
+	service := &runtime.Service{
+		Name:   name,
+		IP:     svc.Spec.ClusterIP,
+		Port:   config.ContainerPort,
+		Status: "Pending",
+	}
+
+	for _, p := range config.Ports {
+		service.Ports = append(service.Ports, runtime.ServicePort{
+			Name:     p.Name,
+			Port:     p.ContainerPort,
+			Protocol: p.Protocol,
+			Public:   p.Public,
+		})
+	}
+
+	return service
+}
+
+// Create deploys an app, updating the deployment if it exists
+func (k *kubeRuntime) Create(name string, config *runtime.ContainerConfig) (*runtime.Service, error) {
+	ctx := context.Background()
+	namespace := k.namespace(name)
+	config = withDefaults(name, config)
+
+	if err := k.ensureNamespace(ctx, namespace); err != nil {
+		return nil, err
+	}
+
+	if err := k.createVolumes(ctx, namespace, name, config.Volumes); err != nil {
+		return nil, err
+	}
+
+	deployments := k.client.AppsV1().Deployments(namespace)
+	deployment := deploymentFromConfig(name, config)
+
+	if _, err := deployments.Create(ctx, deployment, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+		// updates must carry the version of the object they replace
+		existing, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		deployment.ResourceVersion = existing.ResourceVersion
+		if _, err := deployments.Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	svc, err := k.applyService(ctx, namespace, name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return serviceFor(name, svc, config), nil
+}
+
+// Update replaces the pod template of an app and waits for the
+// deployment to roll out, writing progress to out
+func (k *kubeRuntime) Update(name string, config *runtime.ContainerConfig, out io.Writer) error {
+	ctx := context.Background()
+	namespace := k.namespace(name)
+	replicas := 0
+	if config != nil {
+		replicas = config.NumInstances
+	}
+	config = withDefaults(name, config)
+
+	if err := k.createVolumes(ctx, namespace, name, config.Volumes); err != nil {
+		return err
+	}
+
+	deployments := k.client.AppsV1().Deployments(namespace)
+
+	deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	updated := deploymentFromConfig(name, config)
+	deployment.Labels = updated.Labels
+	deployment.Spec.Template = updated.Spec.Template
+	// keep the current replicas unless set
+	if replicas > 0 {
+		deployment.Spec.Replicas = updated.Spec.Replicas
+	}
+
+	deployment, err = deployments.Update(ctx, deployment, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	if _, err := k.applyService(ctx, namespace, name, config); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Rolling out %s\n", name)
+	return k.waitForRollout(ctx, namespace, name, deployment.Generation, out)
+}
+
+// waitForRollout polls a deployment until all replicas are updated and available
+func (k *kubeRuntime) waitForRollout(ctx context.Context, namespace, name string, generation int64, out io.Writer) error {
+	deadline := time.Now().Add(rolloutTimeout)
+
+	for time.Now().Before(deadline) {
+		d, err := k.client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		var want int32 = 1
+		if d.Spec.Replicas != nil {
+			want = *d.Spec.Replicas
+		}
+
+		s := d.Status
+		if s.ObservedGeneration >= generation && s.UpdatedReplicas == want && s.AvailableReplicas == want && s.Replicas == want {
+			fmt.Fprintf(out, "Rolled out %d of %d replicas\n", s.UpdatedReplicas, want)
+			return nil
+		}
+
+		fmt.Fprintf(out, "Waiting for rollout: %d of %d replicas updated, %d available\n", s.UpdatedReplicas, want, s.AvailableReplicas)
+		time.Sleep(time.Second * 3)
+	}
+
+	return errors.New("Timed out waiting for rollout")
+}
+
+// Scale sets the replicas of an app's deployment
+func (k *kubeRuntime) Scale(name string, replicas int) error {
+	ctx := context.Background()
+	deployments := k.client.AppsV1().Deployments(k.namespace(name))
+
+	scale, err := deployments.GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	scale.Spec.Replicas = int32(replicas)
+	_, err = deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+	return err
+}
+
+// Delete removes the deployment, services and autoscaler of an app
+func (k *kubeRuntime) Delete(name string) error {
+	ctx := context.Background()
+	namespace := k.namespace(name)
+
+	var errs []string
+
+	err := k.client.AutoscalingV2().HorizontalPodAutoscalers(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, "autoscaler error: "+err.Error())
+	}
+
+	services, err := k.client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{LabelSelector: appSelector(name)})
+	if err != nil {
+		errs = append(errs, "service error: "+err.Error())
+	} else {
+		for _, svc := range services.Items {
+			if err := k.client.CoreV1().Services(namespace).Delete(ctx, svc.Name, metav1.DeleteOptions{}); err != nil {
+				errs = append(errs, "service error: "+err.Error())
+			}
+		}
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = k.client.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, "deployment error: "+err.Error())
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	"github.com/myodc/playground-server/server/runtime"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testDeployment(t *testing.T, k runtime.Runtime, name string) *appsv1.Deployment {
+	client := k.(*kubeRuntime).client
+	d, err := client.AppsV1().Deployments("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error reading deployment: %v", err)
+	}
+	return d
+}
+
+func TestCreateUpdatesExisting(t *testing.T) {
+	k := NewRuntime(fake.NewSimpleClientset(), nil)
+
+	if _, err := k.Create("foo", &runtime.ContainerConfig{Image: "foo:1", NumInstances: 1}); err != nil {
+		t.Fatalf("Error creating app: %v", err)
+	}
+
+	if _, err := k.Create("foo", &runtime.ContainerConfig{Image: "foo:2", NumInstances: 2}); err != nil {
+		t.Fatalf("Error creating existing app: %v", err)
+	}
+
+	d := testDeployment(t, k, "foo")
+	if image := d.Spec.Template.Spec.Containers[0].Image; image != "foo:2" {
+		t.Errorf("Expected image foo:2, got %s", image)
+	}
+	if *d.Spec.Replicas != 2 {
+		t.Errorf("Expected 2 replicas, got %d", *d.Spec.Replicas)
+	}
+}
+
+func TestCreateScaledToZero(t *testing.T) {
+	k := NewRuntime(fake.NewSimpleClientset(), nil)
+
+	if _, err := k.Create("foo", &runtime.ContainerConfig{Image: "foo:1"}); err != nil {
+		t.Fatalf("Error creating app: %v", err)
+	}
+
+	if d := testDeployment(t, k, "foo"); *d.Spec.Replicas != 0 {
+		t.Errorf("Expected 0 replicas, got %d", *d.Spec.Replicas)
+	}
+}
@@ -0,0 +1,96 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// probeFromCheck translates a health check into a probe
+func probeFromCheck(hc *runtime.HealthCheck, containerPort int) *corev1.Probe {
+	port := hc.Port
+	if port == 0 {
+		port = containerPort
+	}
+
+	probe := &corev1.Probe{
+		InitialDelaySeconds: int32(hc.InitialDelay),
+		PeriodSeconds:       int32(hc.Interval),
+		TimeoutSeconds:      int32(hc.Timeout),
+		SuccessThreshold:    int32(hc.SuccessThreshold),
+		FailureThreshold:    int32(hc.FailureThreshold),
+	}
+
+	switch hc.Type {
+	case runtime.HealthHTTP:
+		probe.HTTPGet = &corev1.HTTPGetAction{
+			Path: hc.Path,
+			Port: intstr.FromInt(port),
+		}
+	case runtime.HealthTCP:
+		probe.TCPSocket = &corev1.TCPSocketAction{
+			Port: intstr.FromInt(port),
+		}
+	case runtime.HealthExec:
+		probe.Exec = &corev1.ExecAction{
+			Command: hc.Command,
+		}
+	}
+
+	return probe
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Health reports readiness of the pods of an app as determined by their probes
+func (k *kubeRuntime) Health(name string) (*runtime.Health, error) {
+	pods, err := k.client.CoreV1().Pods(k.namespace(name)).List(context.Background(), metav1.ListOptions{
+		LabelSelector: appSelector(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	health := &runtime.Health{
+		Instances: len(pods.Items),
+		Checked:   time.Now(),
+	}
+
+	var starting int
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		switch {
+		case podReady(pod):
+			health.Healthy++
+		case pod.Status.Phase == corev1.PodPending:
+			starting++
+		}
+	}
+
+	switch {
+	case health.Instances > 0 && health.Healthy == health.Instances:
+		health.Status = runtime.Healthy
+	case health.Instances == 0 || health.Healthy+starting == health.Instances:
+		health.Status = runtime.Starting
+	default:
+		health.Status = runtime.Unhealthy
+	}
+
+	health.Message = fmt.Sprintf("%d/%d instances ready", health.Healthy, health.Instances)
+	return health, nil
+}
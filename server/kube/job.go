@@ -0,0 +1,140 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/myodc/playground-server/server/runtime"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func jobName(name, run string) string {
+	return name + "-run-" + run
+}
+
+// Run runs a job as a batch job without retries, which are left
+// to the app, and follows the logs of its pod until it exits
+func (k *kubeRuntime) Run(name, run string, job *runtime.Job, out io.Writer) (int, error) {
+	ctx := context.Background()
+	namespace := k.namespace(name)
+
+	if err := k.ensureNamespace(ctx, namespace); err != nil {
+		return 0, err
+	}
+
+	podLabels := make(map[string]string)
+	for key, value := range job.Labels {
+		podLabels[key] = value
+	}
+	// jobs are not labelled as apps so they aren't selected as instances
+	delete(podLabels, "name")
+	podLabels["job"] = name
+	podLabels["type"] = "playground-job"
+
+	var backoff int32
+
+	j := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   jobName(name, run),
+			Labels: podLabels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoff,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: podLabels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Volumes:       volumes(name, job.Volumes),
+					Containers: []corev1.Container{{
+						Name:            name,
+						Image:           job.Image,
+						Env:             envVars(job.Env),
+						VolumeMounts:    volumeMounts(job.Volumes),
+						Resources:       requirements(job.Resources),
+						ImagePullPolicy: corev1.PullAlways,
+					}},
+				},
+			},
+		},
+	}
+
+	jobs := k.client.BatchV1().Jobs(namespace)
+
+	j, err := jobs.Create(ctx, j, metav1.CreateOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	defer jobs.Delete(ctx, j.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+
+	// logs can only be read once the pod is scheduled and started
+	pod, err := k.waitForJobPod(ctx, namespace, j.Name, func(p *corev1.Pod) bool {
+		return p.Status.Phase != corev1.PodPending
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := k.podLogs(ctx, pod, &runtime.LogOptions{Follow: true}, out); err != nil {
+		return 0, err
+	}
+
+	pod, err = k.waitForJobPod(ctx, namespace, j.Name, func(p *corev1.Pod) bool {
+		return p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil {
+			return int(t.ExitCode), nil
+		}
+	}
+
+	if pod.Status.Phase == corev1.PodFailed {
+		return 0, errors.New("Job failed without an exit code")
+	}
+
+	return 0, nil
+}
+
+// waitForJobPod polls the pod of a job until fn is true. It fails
+// once the job is deleted, which is how a run is killed.
+func (k *kubeRuntime) waitForJobPod(ctx context.Context, namespace, job string, fn func(*corev1.Pod) bool) (*corev1.Pod, error) {
+	for {
+		if _, err := k.client.BatchV1().Jobs(namespace).Get(ctx, job, metav1.GetOptions{}); err != nil {
+			return nil, err
+		}
+
+		pods, err := k.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "job-name=" + job,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range pods.Items {
+			if fn(&pods.Items[i]) {
+				return &pods.Items[i], nil
+			}
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+// Kill deletes the job of a run along with its pod
+func (k *kubeRuntime) Kill(name, run string) error {
+	propagation := metav1.DeletePropagationBackground
+	return k.client.BatchV1().Jobs(k.namespace(name)).Delete(context.Background(), jobName(name, run), metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+}
@@ -0,0 +1,175 @@
+// Package kube is the app runtime for current kubernetes clusters,
+// using apps/v1 deployments, core/v1 services and the pod log api.
+// The kubernetes package remains for clusters on the legacy api.
+package kube
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/myodc/playground-server/server/runtime"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	quotaName = "playground-quota"
+)
+
+// NamespaceFunc returns the namespace an app is placed in,
+// blank for the default namespace
+type NamespaceFunc func(name string) string
+
+type kubeRuntime struct {
+	client     kubernetes.Interface
+	namespaces NamespaceFunc
+
+	sync.Mutex
+	// namespaces known to exist
+	ensured map[string]bool
+}
+
+// NewClient returns a client for the cluster in the kubeconfig set
+// by PLAYGROUND_KUBECONFIG or KUBECONFIG, or ~/.kube/config. Without
+// a kubeconfig the in-cluster service account is used.
+func NewClient() (kubernetes.Interface, error) {
+	config, err := clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+func clientConfig() (*rest.Config, error) {
+	path := os.Getenv("PLAYGROUND_KUBECONFIG")
+	if len(path) == 0 {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if len(path) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			if p := filepath.Join(home, ".kube", "config"); fileExists(p) {
+				path = p
+			}
+		}
+	}
+
+	if len(path) == 0 {
+		return rest.InClusterConfig()
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: path},
+		&clientcmd.ConfigOverrides{CurrentContext: os.Getenv("PLAYGROUND_KUBE_CONTEXT")},
+	).ClientConfig()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// NewRuntime returns the runtime for a cluster. Apps are placed in
+// the namespaces returned by fn, which may be nil. Any client may be
+// used, including the fake clientset.
+func NewRuntime(client kubernetes.Interface, fn NamespaceFunc) runtime.Runtime {
+	return &kubeRuntime{
+		client:     client,
+		namespaces: fn,
+		ensured:    make(map[string]bool),
+	}
+}
+
+func (k *kubeRuntime) namespace(name string) string {
+	if k.namespaces != nil {
+		if ns := k.namespaces(name); len(ns) > 0 {
+			return ns
+		}
+	}
+	if ns := os.Getenv("PLAYGROUND_KUBE_NAMESPACE"); len(ns) > 0 {
+		return ns
+	}
+	return corev1.NamespaceDefault
+}
+
+// appSelector selects the objects of an app
+func appSelector(name string) string {
+	return labels.SelectorFromSet(labels.Set{"name": name}).String()
+}
+
+// ensureNamespace creates a namespace labelled as the playground's,
+// along with its resource quota, unless it already exists
+func (k *kubeRuntime) ensureNamespace(ctx context.Context, namespace string) error {
+	k.Lock()
+	defer k.Unlock()
+
+	if k.ensured[namespace] {
+		return nil
+	}
+
+	_, err := k.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		k.ensured[namespace] = true
+		return nil
+	case !apierrors.IsNotFound(err):
+		return err
+	}
+
+	_, err = k.client.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: namespace,
+			Labels: map[string]string{
+				"type":   "playground",
+				"tenant": namespace,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	if hard := quota(); len(hard) > 0 {
+		_, err := k.client.CoreV1().ResourceQuotas(namespace).Create(ctx, &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: quotaName},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		}, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	k.ensured[namespace] = true
+	return nil
+}
+
+// quota returns the hard limits of namespaces created for apps,
+// set by PLAYGROUND_QUOTA_CPU, PLAYGROUND_QUOTA_MEMORY and
+// PLAYGROUND_QUOTA_PODS. Invalid values are ignored.
+func quota() corev1.ResourceList {
+	hard := make(corev1.ResourceList)
+
+	env := map[corev1.ResourceName]string{
+		corev1.ResourceLimitsCPU:    os.Getenv("PLAYGROUND_QUOTA_CPU"),
+		corev1.ResourceLimitsMemory: os.Getenv("PLAYGROUND_QUOTA_MEMORY"),
+		corev1.ResourcePods:         os.Getenv("PLAYGROUND_QUOTA_PODS"),
+	}
+
+	for name, value := range env {
+		if len(value) == 0 {
+			continue
+		}
+		if q, err := resource.ParseQuantity(value); err == nil {
+			hard[name] = q
+		}
+	}
+
+	return hard
+}
@@ -0,0 +1,132 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/myodc/playground-server/server/runtime"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Logs writes the logs of an app's pods, prefixing lines with
+// the pod name when more than one pod is read
+func (k *kubeRuntime) Logs(name string, opts *runtime.LogOptions, out io.Writer) error {
+	ctx := context.Background()
+	pods := k.client.CoreV1().Pods(k.namespace(name))
+
+	if opts == nil {
+		opts = &runtime.LogOptions{}
+	}
+
+	var list []corev1.Pod
+
+	if len(opts.Instance) > 0 {
+		pod, err := pods.Get(ctx, opts.Instance, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if pod.Labels["name"] != name {
+			return errors.New("Instance does not belong to app")
+		}
+		list = append(list, *pod)
+	} else {
+		l, err := pods.List(ctx, metav1.ListOptions{LabelSelector: appSelector(name)})
+		if err != nil {
+			return err
+		}
+		list = l.Items
+	}
+
+	if len(list) == 0 {
+		return errors.New("No instances running")
+	}
+
+	byName := make(map[string]*corev1.Pod)
+	var names []string
+	for i, pod := range list {
+		byName[pod.Name] = &list[i]
+		names = append(names, pod.Name)
+	}
+
+	return runtime.Aggregate(names, opts.Follow, out, func(pod string, w io.Writer) error {
+		return k.podLogs(ctx, byName[pod], opts, w)
+	})
+}
+
+func (k *kubeRuntime) podLogs(ctx context.Context, pod *corev1.Pod, opts *runtime.LogOptions, out io.Writer) error {
+	container := opts.Container
+	if len(container) == 0 {
+		if len(pod.Spec.Containers) != 1 {
+			return errors.New("<container> is required for pods with multiple containers")
+		}
+
+		// Get logs for the only container in the pod
+		container = pod.Spec.Containers[0].Name
+	}
+
+	logOpts := &corev1.PodLogOptions{
+		Container:  container,
+		Follow:     opts.Follow,
+		Previous:   opts.Previous,
+		Timestamps: opts.Timestamps,
+	}
+
+	if opts.Tail > 0 {
+		tail := int64(opts.Tail)
+		logOpts.TailLines = &tail
+	}
+
+	if !opts.Since.IsZero() {
+		since := metav1.NewTime(opts.Since)
+		logOpts.SinceTime = &since
+	}
+
+	readCloser, err := k.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, logOpts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer readCloser.Close()
+
+	_, err = io.Copy(out, readCloser)
+	return err
+}
+
+// Instances lists the pods of an app
+func (k *kubeRuntime) Instances(name string) ([]*runtime.Instance, error) {
+	pods, err := k.client.CoreV1().Pods(k.namespace(name)).List(context.Background(), metav1.ListOptions{
+		LabelSelector: appSelector(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*runtime.Instance
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		instance := &runtime.Instance{
+			Name:    pod.Name,
+			Host:    pod.Spec.NodeName,
+			IP:      pod.Status.PodIP,
+			Phase:   string(pod.Status.Phase),
+			Ready:   podReady(pod),
+			Started: pod.CreationTimestamp.Time,
+		}
+
+		if len(pod.Spec.Containers) > 0 {
+			instance.Image = pod.Spec.Containers[0].Image
+			instance.Resources = resourcesFromContainer(&pod.Spec.Containers[0])
+		}
+
+		for _, cs := range pod.Status.ContainerStatuses {
+			instance.Restarts += int(cs.RestartCount)
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,56 @@
+package kube
+
+import (
+	"github.com/myodc/playground-server/server/runtime"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// requirements converts resources to container requirements.
+// Quantities are validated by the app so parse errors are ignored.
+func requirements(r *runtime.Resources) corev1.ResourceRequirements {
+	if r == nil {
+		return corev1.ResourceRequirements{}
+	}
+
+	return corev1.ResourceRequirements{
+		Requests: resourceList(&r.Requests),
+		Limits:   resourceList(&r.Limits),
+	}
+}
+
+func resourceList(l *runtime.ResourceList) corev1.ResourceList {
+	list := make(corev1.ResourceList)
+
+	if cpu, _ := runtime.ParseCPU(l.CPU); cpu > 0 {
+		list[corev1.ResourceCPU] = *resource.NewMilliQuantity(cpu, resource.DecimalSI)
+	}
+
+	if mem, _ := runtime.ParseMemory(l.Memory); mem > 0 {
+		list[corev1.ResourceMemory] = *resource.NewQuantity(mem, resource.BinarySI)
+	}
+
+	return list
+}
+
+// resourcesFromContainer returns the resources a container was given
+func resourcesFromContainer(c *corev1.Container) *runtime.Resources {
+	return &runtime.Resources{
+		Requests: fromResourceList(c.Resources.Requests),
+		Limits:   fromResourceList(c.Resources.Limits),
+	}
+}
+
+func fromResourceList(list corev1.ResourceList) runtime.ResourceList {
+	var l runtime.ResourceList
+
+	if q, ok := list[corev1.ResourceCPU]; ok {
+		l.CPU = runtime.FormatCPU(q.MilliValue())
+	}
+
+	if q, ok := list[corev1.ResourceMemory]; ok {
+		l.Memory = runtime.FormatMemory(q.Value())
+	}
+
+	return l
+}
@@ -0,0 +1,109 @@
+package kube
+
+import (
+	"context"
+	"os"
+
+	"github.com/myodc/playground-server/server/runtime"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	defaultVolumeSize = "1Gi"
+)
+
+func claimName(name string, vol *runtime.Volume) string {
+	return name + "-" + vol.Name
+}
+
+// volumes returns the pod volumes of an app's claims
+func volumes(name string, vols []runtime.Volume) []corev1.Volume {
+	var list []corev1.Volume
+	for _, vol := range vols {
+		list = append(list, corev1.Volume{
+			Name: vol.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claimName(name, &vol),
+				},
+			},
+		})
+	}
+	return list
+}
+
+func volumeMounts(vols []runtime.Volume) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+	for _, vol := range vols {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      vol.Name,
+			MountPath: vol.MountPath,
+		})
+	}
+	return mounts
+}
+
+// createVolumes creates a persistent volume claim for each volume of
+// an app which doesn't have one. Claims are read write once so apps
+// with volumes should run a single instance. The storage class is
+// set by PLAYGROUND_STORAGE_CLASS, the cluster default otherwise.
+func (k *kubeRuntime) createVolumes(ctx context.Context, namespace, name string, vols []runtime.Volume) error {
+	claims := k.client.CoreV1().PersistentVolumeClaims(namespace)
+
+	for _, vol := range vols {
+		size := vol.Size
+		if len(size) == 0 {
+			size = defaultVolumeSize
+		}
+
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			return err
+		}
+
+		claim := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   claimName(name, &vol),
+				Labels: map[string]string{"name": name},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: q},
+				},
+			},
+		}
+
+		if class := os.Getenv("PLAYGROUND_STORAGE_CLASS"); len(class) > 0 {
+			claim.Spec.StorageClassName = &class
+		}
+
+		if _, err := claims.Create(ctx, claim, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteVolumes removes the persistent volume claims of an app
+func (k *kubeRuntime) DeleteVolumes(name string) error {
+	ctx := context.Background()
+	claims := k.client.CoreV1().PersistentVolumeClaims(k.namespace(name))
+
+	list, err := claims.List(ctx, metav1.ListOptions{LabelSelector: appSelector(name)})
+	if err != nil {
+		return err
+	}
+
+	for _, claim := range list.Items {
+		if err := claims.Delete(ctx, claim.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/myodc/playground-server/server/runtime"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var (
+	playgroundSelector = "type=playground"
+)
+
+// Watch watches the pods, deployments and pod events of playground
+// apps in all namespaces and sends the app state they map to
+func (k *kubeRuntime) Watch(ch chan<- *runtime.StateChange, exit <-chan bool) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts := metav1.ListOptions{LabelSelector: playgroundSelector}
+
+	// restart counts of pod containers last seen
+	restarts := make(map[string]int32)
+
+	// apps of playground pods by namespace/name, events only
+	// reference the pod so are mapped back to an app through it
+	pods := make(map[string]string)
+
+	podWatch, err := k.client.CoreV1().Pods(corev1.NamespaceAll).Watch(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer podWatch.Stop()
+
+	deployWatch, err := k.client.AppsV1().Deployments(corev1.NamespaceAll).Watch(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer deployWatch.Stop()
+
+	// events have no labels of their own, only those of pods are
+	// watched and from now on so past events aren't replayed
+	eventOpts := metav1.ListOptions{FieldSelector: "involvedObject.kind=Pod"}
+	events, err := k.client.CoreV1().Events(corev1.NamespaceAll).List(ctx, eventOpts)
+	if err != nil {
+		return err
+	}
+	eventOpts.ResourceVersion = events.ResourceVersion
+
+	eventWatch, err := k.client.CoreV1().Events(corev1.NamespaceAll).Watch(ctx, eventOpts)
+	if err != nil {
+		return err
+	}
+	defer eventWatch.Stop()
+
+	for {
+		select {
+		case <-exit:
+			return nil
+		case ev, ok := <-podWatch.ResultChan():
+			if !ok {
+				return errors.New("Pod watch closed")
+			}
+			pod, ok := ev.Object.(*corev1.Pod)
+			if !ok {
+				continue
+			}
+			if ev.Type == watch.Deleted {
+				for _, cs := range pod.Status.ContainerStatuses {
+					delete(restarts, string(pod.UID)+"/"+cs.Name)
+				}
+				delete(pods, pod.Namespace+"/"+pod.Name)
+				continue
+			}
+			if name, ok := pod.Labels["name"]; ok {
+				pods[pod.Namespace+"/"+pod.Name] = name
+				if change := podState(pod, restarts); change != nil {
+					change.Name = name
+					ch <- change
+				}
+			}
+		case ev, ok := <-deployWatch.ResultChan():
+			if !ok {
+				return errors.New("Deployment watch closed")
+			}
+			d, ok := ev.Object.(*appsv1.Deployment)
+			if !ok {
+				continue
+			}
+			name, ok := d.Labels["name"]
+			if !ok {
+				continue
+			}
+			if ev.Type == watch.Deleted || (d.Spec.Replicas != nil && *d.Spec.Replicas == 0) {
+				ch <- &runtime.StateChange{
+					Name:    name,
+					State:   runtime.StateStopped,
+					Reason:  "Deployment",
+					Message: "No replicas scheduled",
+				}
+			}
+		case ev, ok := <-eventWatch.ResultChan():
+			if !ok {
+				return errors.New("Event watch closed")
+			}
+			e, ok := ev.Object.(*corev1.Event)
+			if !ok || ev.Type == watch.Deleted {
+				continue
+			}
+			name, ok := pods[e.InvolvedObject.Namespace+"/"+e.InvolvedObject.Name]
+			if !ok {
+				continue
+			}
+			if change := eventState(e); change != nil {
+				change.Name = name
+				ch <- change
+			}
+		}
+	}
+}
+
+// eventState maps an event of a pod to an app state, for failures
+// which don't show in the status of the pod
+func eventState(e *corev1.Event) *runtime.StateChange {
+	var state string
+	switch reason := strings.ToLower(e.Reason); {
+	case strings.Contains(reason, "failedscheduling"):
+		state = runtime.StatePending
+	case strings.Contains(reason, "pull") && strings.Contains(reason, "fail"):
+		state = runtime.StateImagePullError
+	case strings.Contains(reason, "backoff"):
+		state = runtime.StateCrashLooping
+	default:
+		return nil
+	}
+
+	return &runtime.StateChange{
+		State:   state,
+		Reason:  e.Reason,
+		Message: e.Message,
+	}
+}
+
+// oomKilled returns true if a container was killed for running out
+// of memory since the pod was last seen. The last termination stays
+// after the container recovers so it only counts on a new restart.
+func oomKilled(pod *corev1.Pod, cs corev1.ContainerStatus, restarts map[string]int32) bool {
+	if t := cs.State.Terminated; t != nil {
+		return t.Reason == "OOMKilled"
+	}
+
+	key := string(pod.UID) + "/" + cs.Name
+	seen, ok := restarts[key]
+	restarts[key] = cs.RestartCount
+
+	t := cs.LastTerminationState.Terminated
+	return ok && seen != cs.RestartCount && t != nil && t.Reason == "OOMKilled"
+}
+
+// podState maps the status of a pod to an app state. Running but
+// not ready pods are left to the health checks.
+func podState(pod *corev1.Pod, restarts map[string]int32) *runtime.StateChange {
+	// every container's restarts are recorded before reporting any
+	var oom []string
+	for _, cs := range pod.Status.ContainerStatuses {
+		if oomKilled(pod, cs, restarts) {
+			oom = append(oom, cs.Name)
+		}
+	}
+
+	if len(oom) > 0 {
+		return &runtime.StateChange{
+			State:   runtime.StateOOMKilled,
+			Reason:  "OOMKilled",
+			Message: fmt.Sprintf("Container %s ran out of memory", strings.Join(oom, ", ")),
+		}
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil {
+			switch {
+			case strings.Contains(w.Reason, "Image") || strings.Contains(w.Reason, "Pull"):
+				return &runtime.StateChange{
+					State:   runtime.StateImagePullError,
+					Reason:  w.Reason,
+					Message: fmt.Sprintf("Could not pull image %s", cs.Image),
+				}
+			case w.Reason == "CrashLoopBackOff" || cs.RestartCount > 0:
+				return &runtime.StateChange{
+					State:   runtime.StateCrashLooping,
+					Reason:  w.Reason,
+					Message: fmt.Sprintf("Container %s restarted %d times", cs.Name, cs.RestartCount),
+				}
+			}
+		}
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodPending:
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse {
+				return &runtime.StateChange{
+					State:   runtime.StatePending,
+					Reason:  cond.Reason,
+					Message: cond.Message,
+				}
+			}
+		}
+		return &runtime.StateChange{
+			State:   runtime.StatePending,
+			Reason:  "Pod pending",
+			Message: pod.Status.Message,
+		}
+	case corev1.PodRunning:
+		if !podReady(pod) {
+			return nil
+		}
+		return &runtime.StateChange{
+			State:   runtime.StateRunning,
+			Reason:  "Pod running",
+			Message: fmt.Sprintf("Pod %s ready on %s", pod.Name, pod.Spec.NodeName),
+		}
+	case corev1.PodFailed:
+		return &runtime.StateChange{
+			State:   runtime.StateFailed,
+			Reason:  "Pod failed",
+			Message: pod.Status.Message,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+// probeFromCheck translates a health check into a probe. The
+// legacy api has no period or thresholds so kubelet defaults apply.
+func probeFromCheck(hc *runtime.HealthCheck, containerPort int) *api.Probe {
+	port := hc.Port
+	if port == 0 {
+		port = containerPort
+	}
+
+	probe := &api.Probe{
+		InitialDelaySeconds: int64(hc.InitialDelay),
+		TimeoutSeconds:      int64(hc.Timeout),
+	}
+
+	switch hc.Type {
+	case runtime.HealthHTTP:
+		probe.Handler.HTTPGet = &api.HTTPGetAction{
+			Path: hc.Path,
+			Port: util.NewIntOrStringFromInt(port),
+		}
+	case runtime.HealthTCP:
+		probe.Handler.TCPSocket = &api.TCPSocketAction{
+			Port: util.NewIntOrStringFromInt(port),
+		}
+	case runtime.HealthExec:
+		probe.Handler.Exec = &api.ExecAction{
+			Command: hc.Command,
+		}
+	}
+
+	return probe
+}
+
+func podReady(pod *api.Pod) bool {
+	if pod.Status.Phase != api.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == api.PodReady {
+			return cond.Status == api.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Health reports readiness of the pods of an app as determined by their probes
+func (k *kubeRuntime) Health(name string) (*runtime.Health, error) {
+	namespace := k.namespace(name)
+
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := client.Pods(namespace).List(labels.SelectorFromSet(labels.Set{"name": name}))
+	if err != nil {
+		return nil, err
+	}
+
+	health := &runtime.Health{
+		Instances: len(pods.Items),
+		Checked:   time.Now(),
+	}
+
+	var starting int
+	for _, pod := range pods.Items {
+		switch {
+		case podReady(&pod):
+			health.Healthy++
+		case pod.Status.Phase == api.PodPending:
+			starting++
+		}
+	}
+
+	switch {
+	case health.Instances > 0 && health.Healthy == health.Instances:
+		health.Status = runtime.Healthy
+	case health.Instances == 0 || health.Healthy+starting == health.Instances:
+		health.Status = runtime.Starting
+	default:
+		health.Status = runtime.Unhealthy
+	}
+
+	health.Message = fmt.Sprintf("%d/%d instances ready", health.Healthy, health.Instances)
+	return health, nil
+}
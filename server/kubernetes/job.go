@@ -0,0 +1,121 @@
+package kubernetes
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+func jobPodName(name, run string) string {
+	return name + "-run-" + run
+}
+
+// Run runs a job as a pod which is never restarted. The legacy api
+// has no job resource so the pod is watched here until it exits.
+func Run(namespace, name, run string, job *runtime.Job, out io.Writer) (int, error) {
+	client, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := ensureNamespace(client, namespace); err != nil {
+		return 0, err
+	}
+
+	podLabels := make(map[string]string)
+	for k, v := range job.Labels {
+		podLabels[k] = v
+	}
+	// jobs are not labelled as apps so they aren't selected as instances
+	delete(podLabels, "name")
+	podLabels["job"] = name
+	podLabels["type"] = "playground-job"
+
+	volumes, mounts := volumesFromConfig(name, &runtime.ContainerConfig{Volumes: job.Volumes})
+
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:   jobPodName(name, run),
+			Labels: podLabels,
+		},
+		Spec: api.PodSpec{
+			RestartPolicy: api.RestartPolicy{Never: &api.RestartPolicyNever{}},
+			Volumes:       volumes,
+			Containers: []api.Container{{
+				Name:            name,
+				Image:           job.Image,
+				Env:             envVars(job.Env),
+				VolumeMounts:    mounts,
+				Resources:       requirements(job.Resources),
+				ImagePullPolicy: api.PullAlways,
+			}},
+		},
+	}
+
+	pod, err = client.Pods(namespace).Create(pod)
+	if err != nil {
+		return 0, err
+	}
+
+	defer client.Pods(namespace).Delete(pod.Name)
+
+	// logs can only be read once the pod is scheduled and started
+	pod, err = waitForPod(client, namespace, pod.Name, func(p *api.Pod) bool {
+		return p.Status.Phase != api.PodPending
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := podLogs(client, pod, &runtime.LogOptions{Follow: true}, out); err != nil {
+		return 0, err
+	}
+
+	pod, err = waitForPod(client, namespace, pod.Name, func(p *api.Pod) bool {
+		return p.Status.Phase == api.PodSucceeded || p.Status.Phase == api.PodFailed
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Termination; t != nil {
+			return t.ExitCode, nil
+		}
+	}
+
+	if pod.Status.Phase == api.PodFailed {
+		return 0, errors.New("Job failed without an exit code")
+	}
+
+	return 0, nil
+}
+
+// waitForPod polls a pod until fn is true. It fails once the
+// pod is deleted, which is how a run is killed.
+func waitForPod(client *client.Client, namespace, name string, fn func(*api.Pod) bool) (*api.Pod, error) {
+	for {
+		pod, err := client.Pods(namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if fn(pod) {
+			return pod, nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Kill deletes the pod of a run
+func Kill(namespace, name, run string) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return client.Pods(namespace).Delete(jobPodName(name, run))
+}
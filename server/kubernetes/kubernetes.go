@@ -9,30 +9,16 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	apierrors "github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubectl"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
-	log "github.com/cihub/seelog"
+	"github.com/myodc/playground-server/server/runtime"
 )
 
-type ContainerConfig struct {
-	Image         string
-	ContainerPort int
-	NumInstances  int
-	Labels        map[string]string
-}
-
-type Service struct {
-	Name   string
-	IP     string
-	Port   int
-	Status string
-}
-
 var (
-	defaultPort      = 8080
-	defaultNamespace = "default"
+	defaultPort = 8080
 )
 
 func newClient() (*client.Client, error) {
@@ -50,36 +36,17 @@ func newClient() (*client.Client, error) {
 	return client.New(config)
 }
 
-func EventWatcher() {
-	client, err := newClient()
-	if err != nil {
-		log.Error(err)
-		return
-	}
-
-	el, err := client.Events(defaultNamespace).List(labels.OneTermEqualSelector("involvedObject.Name", "type"), labels.OneTermEqualSelector("involvedObject.Name", "playground"))
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	rv := el.ListMeta.ResourceVersion
-	log.Debug(el)
-	w, err := client.Events(defaultNamespace).Watch(labels.OneTermEqualSelector("involvedObject.Name", "type"), labels.OneTermEqualSelector("involvedObject.Name", "playground"), rv)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	for {
-		select {
-		case e := <-w.ResultChan():
-			log.Debugf("Result %v", e)
-		}
+func envVars(env map[string]string) []api.EnvVar {
+	var vars []api.EnvVar
+	for _, k := range runtime.EnvKeys(env) {
+		vars = append(vars, api.EnvVar{Name: k, Value: env[k]})
 	}
+	return vars
 }
 
-func replCtrlFromConfig(name string, config *ContainerConfig) *api.ReplicationController {
+func replCtrlFromConfig(name string, config *runtime.ContainerConfig) *api.ReplicationController {
 	if config == nil {
-		config = &ContainerConfig{}
+		config = &runtime.ContainerConfig{}
 	}
 
 	if config.ContainerPort == 0 {
@@ -92,17 +59,41 @@ func replCtrlFromConfig(name string, config *ContainerConfig) *api.ReplicationCo
 
 	config.Labels["name"] = name
 
+	if len(config.Ports) == 0 {
+		config.Ports = []runtime.Port{{
+			Name:          "http",
+			ContainerPort: config.ContainerPort,
+			Protocol:      runtime.ProtocolHTTP,
+			Public:        true,
+		}}
+	}
+
+	var ports []api.Port
+	for _, port := range config.Ports {
+		ports = append(ports, api.Port{
+			Name:          port.Name,
+			ContainerPort: port.ContainerPort,
+			Protocol:      api.Protocol(port.Transport()),
+		})
+	}
+
+	volumes, mounts := volumesFromConfig(name, config)
+
 	container := api.Container{
-		Name:  name,
-		Image: config.Image,
-		Ports: []api.Port{
-			api.Port{
-				ContainerPort: config.ContainerPort,
-			},
-		},
+		Name:            name,
+		Image:           config.Image,
+		Ports:           ports,
+		Env:             envVars(config.Env),
+		VolumeMounts:    mounts,
+		Resources:       requirements(config.Resources),
 		ImagePullPolicy: api.PullAlways,
 	}
 
+	if hc := config.HealthCheck; hc != nil {
+		container.LivenessProbe = probeFromCheck(hc, config.ContainerPort)
+		container.ReadinessProbe = probeFromCheck(hc, config.ContainerPort)
+	}
+
 	return &api.ReplicationController{
 		api.TypeMeta{
 			Kind:       "ReplicationController",
@@ -123,6 +114,7 @@ func replCtrlFromConfig(name string, config *ContainerConfig) *api.ReplicationCo
 					Labels: config.Labels,
 				},
 				api.PodSpec{
+					Volumes: volumes,
 					Containers: []api.Container{
 						container,
 					},
@@ -133,19 +125,74 @@ func replCtrlFromConfig(name string, config *ContainerConfig) *api.ReplicationCo
 	}
 }
 
-func Create(name string, config *ContainerConfig) (*Service, error) {
+func Create(namespace, name string, config *runtime.ContainerConfig) (*runtime.Service, error) {
 	client, err := newClient()
 	if err != nil {
 		return nil, err
 	}
 
+	if err := ensureNamespace(client, namespace); err != nil {
+		return nil, err
+	}
+
 	repl := replCtrlFromConfig(name, config)
-	repl, err = client.ReplicationControllers(defaultNamespace).Create(repl)
+	repl, err = client.ReplicationControllers(namespace).Create(repl)
 	if err != nil {
 		return nil, err
 	}
 
-	// create service config
+	// the primary port is served on the default port
+	service, err := createService(client, namespace, name, config.Labels, defaultPort, &runtime.Port{
+		ContainerPort: config.ContainerPort,
+		Protocol:      runtime.ProtocolTCP,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &runtime.Service{
+		Name:   name,
+		IP:     service.Spec.PortalIP,
+		Port:   service.Spec.Port,
+		Status: "Pending",
+	}
+
+	// the legacy api has a single port per service so public
+	// ports each get a service named after the port
+	for _, port := range config.Ports {
+		sp := runtime.ServicePort{
+			Name:     port.Name,
+			Port:     port.ContainerPort,
+			Protocol: port.Protocol,
+			Public:   port.Public,
+		}
+
+		if port.ContainerPort == config.ContainerPort {
+			sp.Port = service.Spec.Port
+		} else if port.Public {
+			portLabels := make(map[string]string)
+			for k, v := range config.Labels {
+				portLabels[k] = v
+			}
+			// only http ports can be routed by the proxy
+			if port.Protocol != runtime.ProtocolHTTP {
+				delete(portLabels, "proxy")
+			}
+
+			p := port
+			if _, err := createService(client, namespace, name+"-"+port.Name, portLabels, port.ContainerPort, &p); err != nil {
+				return nil, err
+			}
+		}
+
+		svc.Ports = append(svc.Ports, sp)
+	}
+
+	// save pod and service state
+	return svc, nil
+}
+
+func createService(client *client.Client, namespace, name string, svcLabels map[string]string, port int, target *runtime.Port) (*api.Service, error) {
 	service := &api.Service{
 		api.TypeMeta{
 			Kind:       "Service",
@@ -153,45 +200,35 @@ func Create(name string, config *ContainerConfig) (*Service, error) {
 		},
 		api.ObjectMeta{
 			Name:   name,
-			Labels: config.Labels,
+			Labels: svcLabels,
 		},
 		api.ServiceSpec{
-			Port: defaultPort,
+			Port:     port,
+			Protocol: api.Protocol(target.Transport()),
 			Selector: map[string]string{
-				"name": name,
+				"name": svcLabels["name"],
 			},
-			ContainerPort: util.NewIntOrStringFromInt(config.ContainerPort),
+			ContainerPort: util.NewIntOrStringFromInt(target.ContainerPort),
 		},
 		api.ServiceStatus{},
 	}
 
-	service, err = client.Services(defaultNamespace).Create(service)
-	if err != nil {
-		return nil, err
-	}
-
-	// save pod and service state
-	return &Service{
-		Name:   name,
-		IP:     service.Spec.PortalIP,
-		Port:   service.Spec.Port,
-		Status: "Pending",
-	}, nil
+	return client.Services(namespace).Create(service)
 }
 
-func Update(name string, config *ContainerConfig, out io.Writer) error {
+func Update(namespace, name string, config *runtime.ContainerConfig, out io.Writer) error {
 	client, err := newClient()
 	if err != nil {
 		return err
 	}
 
-	oldRc, err := client.ReplicationControllers(defaultNamespace).Get(name)
+	oldRc, err := client.ReplicationControllers(namespace).Get(name)
 	if err != nil {
 		return err
 	}
 	newRc := replCtrlFromConfig(name, config)
 
-	updater := kubectl.NewRollingUpdater(defaultNamespace, client)
+	updater := kubectl.NewRollingUpdater(namespace, client)
 
 	var hasLabel bool
 	for key, oldValue := range oldRc.Spec.Selector {
@@ -210,7 +247,24 @@ func Update(name string, config *ContainerConfig, out io.Writer) error {
 	return updater.Update(out, oldRc, newRc, time.Minute, time.Second*3, time.Minute*5)
 }
 
-func Delete(name string) error {
+// Scale sets the replicas of an app's replication controller
+func Scale(namespace, name string, replicas int) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	rc, err := client.ReplicationControllers(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+
+	rc.Spec.Replicas = replicas
+	_, err = client.ReplicationControllers(namespace).Update(rc)
+	return err
+}
+
+func Delete(namespace, name string) error {
 	client, err := newClient()
 	if err != nil {
 		return err
@@ -218,21 +272,32 @@ func Delete(name string) error {
 
 	var errs []string
 
-	if err := client.Services(defaultNamespace).Delete(name); err != nil {
+	// includes the services of additional ports
+	services, err := client.Services(namespace).List(labels.SelectorFromSet(labels.Set{"name": name}))
+	if err != nil {
 		errs = append(errs, "service error: "+err.Error())
+	} else {
+		for _, service := range services.Items {
+			if err := client.Services(namespace).Delete(service.Name); err != nil {
+				errs = append(errs, "service error: "+err.Error())
+			}
+		}
 	}
 
-	oldRc, err := client.ReplicationControllers(defaultNamespace).Get(name)
-	if err != nil {
+	// apps which are not running have no replication controller
+	oldRc, err := client.ReplicationControllers(namespace).Get(name)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
 		errs = append(errs, "replication controller error: "+err.Error())
-	} else {
+	default:
 		oldRc.Spec.Replicas = 0
-		if _, err := client.ReplicationControllers(defaultNamespace).Update(oldRc); err != nil {
+		if _, err := client.ReplicationControllers(namespace).Update(oldRc); err != nil {
 			errs = append(errs, "replication controller error: "+err.Error())
 		}
 
 		time.Sleep(time.Second * 10)
-		if err := client.ReplicationControllers(defaultNamespace).Delete(name); err != nil {
+		if err := client.ReplicationControllers(namespace).Delete(name); err != nil && !apierrors.IsNotFound(err) {
 			errs = append(errs, "replication controller error: "+err.Error())
 		}
 	}
@@ -243,17 +308,55 @@ func Delete(name string) error {
 	return nil
 }
 
-func Logs(id, container string, out io.Writer) error {
+// Logs writes the logs of an app's pods, prefixing lines with
+// the pod name when more than one pod is read
+func Logs(namespace, name string, opts *runtime.LogOptions, out io.Writer) error {
 	client, err := newClient()
 	if err != nil {
 		return err
 	}
 
-	pod, err := client.Pods(defaultNamespace).Get(id)
-	if err != nil {
-		return err
+	if opts == nil {
+		opts = &runtime.LogOptions{}
+	}
+
+	var pods []api.Pod
+
+	if len(opts.Instance) > 0 {
+		pod, err := client.Pods(namespace).Get(opts.Instance)
+		if err != nil {
+			return err
+		}
+		if pod.Labels["name"] != name {
+			return errors.New("Instance does not belong to app")
+		}
+		pods = append(pods, *pod)
+	} else {
+		list, err := client.Pods(namespace).List(labels.SelectorFromSet(labels.Set{"name": name}))
+		if err != nil {
+			return err
+		}
+		pods = list.Items
+	}
+
+	if len(pods) == 0 {
+		return errors.New("No instances running")
 	}
 
+	byName := make(map[string]*api.Pod)
+	var names []string
+	for i, pod := range pods {
+		byName[pod.Name] = &pods[i]
+		names = append(names, pod.Name)
+	}
+
+	return runtime.Aggregate(names, opts.Follow, out, func(pod string, w io.Writer) error {
+		return podLogs(client, byName[pod], opts, w)
+	})
+}
+
+func podLogs(client *client.Client, pod *api.Pod, opts *runtime.LogOptions, out io.Writer) error {
+	container := opts.Container
 	if len(container) == 0 {
 		if len(pod.Spec.Containers) != 1 {
 			return errors.New("<container> is required for pods with multiple containers")
@@ -263,14 +366,24 @@ func Logs(id, container string, out io.Writer) error {
 		container = pod.Spec.Containers[0].Name
 	}
 
-	readCloser, err := client.RESTClient.Get().
+	req := client.RESTClient.Get().
 		Prefix("proxy").
 		Resource("minions").
 		Name(pod.Status.Host).
-		Suffix("containerLogs", defaultNamespace, id, container).
-		Param("follow", strconv.FormatBool(false)).
-		Stream()
+		Suffix("containerLogs", pod.Namespace, pod.Name, container).
+		Param("follow", strconv.FormatBool(opts.Follow)).
+		Param("previous", strconv.FormatBool(opts.Previous)).
+		Param("timestamps", strconv.FormatBool(opts.Timestamps))
+
+	if opts.Tail > 0 {
+		req = req.Param("tail", strconv.Itoa(opts.Tail))
+	}
+
+	if !opts.Since.IsZero() {
+		req = req.Param("sinceTime", opts.Since.UTC().Format(time.RFC3339))
+	}
 
+	readCloser, err := req.Stream()
 	if err != nil {
 		return err
 	}
@@ -284,3 +397,40 @@ func Logs(id, container string, out io.Writer) error {
 
 	return nil
 }
+
+func Instances(namespace, name string) ([]*runtime.Instance, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := client.Pods(namespace).List(labels.SelectorFromSet(labels.Set{"name": name}))
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*runtime.Instance
+	for _, pod := range pods.Items {
+		instance := &runtime.Instance{
+			Name:    pod.Name,
+			Host:    pod.Status.Host,
+			IP:      pod.Status.PodIP,
+			Phase:   string(pod.Status.Phase),
+			Ready:   podReady(&pod),
+			Started: pod.CreationTimestamp.Time,
+		}
+
+		if len(pod.Spec.Containers) > 0 {
+			instance.Image = pod.Spec.Containers[0].Image
+			instance.Resources = resourcesFromContainer(&pod.Spec.Containers[0])
+		}
+
+		for _, cs := range pod.Status.ContainerStatuses {
+			instance.Restarts += cs.RestartCount
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
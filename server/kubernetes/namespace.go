@@ -0,0 +1,102 @@
+package kubernetes
+
+import (
+	"os"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/resource"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+)
+
+var (
+	quotaName = "playground-quota"
+
+	nsMtx sync.Mutex
+	// namespaces known to exist
+	namespaces = make(map[string]bool)
+)
+
+// defaultNamespace is where apps without a namespace are placed,
+// set by PLAYGROUND_KUBE_NAMESPACE
+func defaultNamespace() string {
+	if ns := os.Getenv("PLAYGROUND_KUBE_NAMESPACE"); len(ns) > 0 {
+		return ns
+	}
+	return api.NamespaceDefault
+}
+
+// quota returns the hard limits of namespaces created for apps,
+// set by PLAYGROUND_QUOTA_CPU, PLAYGROUND_QUOTA_MEMORY and
+// PLAYGROUND_QUOTA_PODS. Invalid values are ignored.
+func quota() api.ResourceList {
+	hard := make(api.ResourceList)
+
+	env := map[api.ResourceName]string{
+		api.ResourceCPU:    os.Getenv("PLAYGROUND_QUOTA_CPU"),
+		api.ResourceMemory: os.Getenv("PLAYGROUND_QUOTA_MEMORY"),
+		api.ResourcePods:   os.Getenv("PLAYGROUND_QUOTA_PODS"),
+	}
+
+	for name, value := range env {
+		if len(value) == 0 {
+			continue
+		}
+		if q, err := resource.ParseQuantity(value); err == nil {
+			hard[name] = *q
+		}
+	}
+
+	return hard
+}
+
+// ensureNamespace creates a namespace labelled as the playground's,
+// along with its resource quota, unless it already exists
+func ensureNamespace(client *client.Client, namespace string) error {
+	nsMtx.Lock()
+	defer nsMtx.Unlock()
+
+	if namespaces[namespace] {
+		return nil
+	}
+
+	_, err := client.Namespaces().Get(namespace)
+	switch {
+	case err == nil:
+		namespaces[namespace] = true
+		return nil
+	case !errors.IsNotFound(err):
+		return err
+	}
+
+	_, err = client.Namespaces().Create(&api.Namespace{
+		ObjectMeta: api.ObjectMeta{
+			Name: namespace,
+			Labels: map[string]string{
+				"type":   "playground",
+				"tenant": namespace,
+			},
+		},
+	})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	if hard := quota(); len(hard) > 0 {
+		_, err := client.ResourceQuotas(namespace).Create(&api.ResourceQuota{
+			ObjectMeta: api.ObjectMeta{
+				Name: quotaName,
+			},
+			Spec: api.ResourceQuotaSpec{
+				Hard: hard,
+			},
+		})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	namespaces[namespace] = true
+	return nil
+}
@@ -0,0 +1,56 @@
+package kubernetes
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/resource"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+// requirements converts resources to container requirements.
+// Quantities are validated by the app so parse errors are ignored.
+func requirements(r *runtime.Resources) api.ResourceRequirements {
+	if r == nil {
+		return api.ResourceRequirements{}
+	}
+
+	return api.ResourceRequirements{
+		Requests: resourceList(&r.Requests),
+		Limits:   resourceList(&r.Limits),
+	}
+}
+
+func resourceList(l *runtime.ResourceList) api.ResourceList {
+	list := make(api.ResourceList)
+
+	if cpu, _ := runtime.ParseCPU(l.CPU); cpu > 0 {
+		list[api.ResourceCPU] = *resource.NewMilliQuantity(cpu, resource.DecimalSI)
+	}
+
+	if mem, _ := runtime.ParseMemory(l.Memory); mem > 0 {
+		list[api.ResourceMemory] = *resource.NewQuantity(mem, resource.BinarySI)
+	}
+
+	return list
+}
+
+// resourcesFromContainer returns the resources a container was given
+func resourcesFromContainer(c *api.Container) *runtime.Resources {
+	return &runtime.Resources{
+		Requests: fromResourceList(c.Resources.Requests),
+		Limits:   fromResourceList(c.Resources.Limits),
+	}
+}
+
+func fromResourceList(list api.ResourceList) runtime.ResourceList {
+	var l runtime.ResourceList
+
+	if q, ok := list[api.ResourceCPU]; ok {
+		l.CPU = runtime.FormatCPU(q.MilliValue())
+	}
+
+	if q, ok := list[api.ResourceMemory]; ok {
+		l.Memory = runtime.FormatMemory(q.Value())
+	}
+
+	return l
+}
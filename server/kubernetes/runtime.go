@@ -0,0 +1,66 @@
+package kubernetes
+
+import (
+	"io"
+
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+type kubeRuntime struct {
+	namespaces NamespaceFunc
+}
+
+// NamespaceFunc returns the namespace an app is placed in,
+// blank for the default namespace
+type NamespaceFunc func(name string) string
+
+// NewRuntime returns the kubernetes app runtime. Apps are placed
+// in the namespaces returned by fn, which may be nil.
+func NewRuntime(fn NamespaceFunc) runtime.Runtime {
+	return &kubeRuntime{namespaces: fn}
+}
+
+func (k *kubeRuntime) namespace(name string) string {
+	if k.namespaces != nil {
+		if ns := k.namespaces(name); len(ns) > 0 {
+			return ns
+		}
+	}
+	return defaultNamespace()
+}
+
+func (k *kubeRuntime) Create(name string, config *runtime.ContainerConfig) (*runtime.Service, error) {
+	return Create(k.namespace(name), name, config)
+}
+
+func (k *kubeRuntime) Update(name string, config *runtime.ContainerConfig, out io.Writer) error {
+	return Update(k.namespace(name), name, config, out)
+}
+
+func (k *kubeRuntime) Delete(name string) error {
+	return Delete(k.namespace(name), name)
+}
+
+func (k *kubeRuntime) Logs(name string, opts *runtime.LogOptions, out io.Writer) error {
+	return Logs(k.namespace(name), name, opts, out)
+}
+
+func (k *kubeRuntime) Instances(name string) ([]*runtime.Instance, error) {
+	return Instances(k.namespace(name), name)
+}
+
+func (k *kubeRuntime) Scale(name string, replicas int) error {
+	return Scale(k.namespace(name), name, replicas)
+}
+
+func (k *kubeRuntime) DeleteVolumes(name string) error {
+	return DeleteVolumes(k.namespace(name), name)
+}
+
+func (k *kubeRuntime) Run(name, run string, job *runtime.Job, out io.Writer) (int, error) {
+	return Run(k.namespace(name), name, run, job, out)
+}
+
+func (k *kubeRuntime) Kill(name, run string) error {
+	return Kill(k.namespace(name), name, run)
+}
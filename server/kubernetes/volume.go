@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+var (
+	defaultVolumeDir = "/var/lib/playground/volumes"
+)
+
+// volumeDir is the node directory volumes are kept in. The legacy
+// api has no persistent volume claims so volumes are host paths,
+// which means pods should be pinned to nodes for data to follow them.
+func volumeDir() string {
+	if dir := os.Getenv("PLAYGROUND_VOLUME_DIR"); len(dir) > 0 {
+		return dir
+	}
+	return defaultVolumeDir
+}
+
+func volumePath(name string, vol *runtime.Volume) string {
+	return filepath.Join(volumeDir(), name, vol.Name)
+}
+
+func volumesFromConfig(name string, config *runtime.ContainerConfig) ([]api.Volume, []api.VolumeMount) {
+	var volumes []api.Volume
+	var mounts []api.VolumeMount
+
+	for _, vol := range config.Volumes {
+		volumes = append(volumes, api.Volume{
+			Name: vol.Name,
+			VolumeSource: api.VolumeSource{
+				HostPath: &api.HostPathVolumeSource{
+					Path: volumePath(name, &vol),
+				},
+			},
+		})
+		mounts = append(mounts, api.VolumeMount{
+			Name:      vol.Name,
+			MountPath: vol.MountPath,
+		})
+	}
+
+	return volumes, mounts
+}
+
+// DeleteVolumes removes the volume directories of an app by running
+// a cleanup pod on every node since the data may be on any of them
+func DeleteVolumes(namespace, name string) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	nodes, err := client.Nodes().List()
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes.Items {
+		pod := &api.Pod{
+			ObjectMeta: api.ObjectMeta{
+				GenerateName: "playground-purge-" + name + "-",
+				Labels: map[string]string{
+					"type": "playground-purge",
+				},
+			},
+			Spec: api.PodSpec{
+				Host:          node.Name,
+				RestartPolicy: api.RestartPolicy{Never: &api.RestartPolicyNever{}},
+				Volumes: []api.Volume{{
+					Name: "volumes",
+					VolumeSource: api.VolumeSource{
+						HostPath: &api.HostPathVolumeSource{Path: volumeDir()},
+					},
+				}},
+				Containers: []api.Container{{
+					Name:    "purge",
+					Image:   "busybox",
+					Command: []string{"rm", "-rf", filepath.Join("/volumes", name)},
+					VolumeMounts: []api.VolumeMount{{
+						Name:      "volumes",
+						MountPath: "/volumes",
+					}},
+				}},
+			},
+		}
+
+		if _, err := client.Pods(namespace).Create(pod); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+// watcher tracks playground pods so events, which only
+// reference the pod name, can be mapped back to an app
+type watcher struct {
+	sync.RWMutex
+	pods map[string]string
+	// restart counts of pod containers last seen
+	restarts map[string]int
+}
+
+var (
+	playgroundSelector = labels.SelectorFromSet(labels.Set{"type": "playground"})
+)
+
+// Watch lists then watches pods, replication controllers and events
+// of playground apps and sends the app state they map to
+func (k *kubeRuntime) Watch(ch chan<- *runtime.StateChange, exit <-chan bool) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	w := &watcher{
+		pods:     make(map[string]string),
+		restarts: make(map[string]int),
+	}
+
+	pods, err := client.Pods(api.NamespaceAll).List(playgroundSelector)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		w.pod(&pod, ch)
+	}
+
+	podWatch, err := client.Pods(api.NamespaceAll).Watch(playgroundSelector, labels.Everything(), pods.ResourceVersion)
+	if err != nil {
+		return err
+	}
+	defer podWatch.Stop()
+
+	rcWatch, err := client.ReplicationControllers(api.NamespaceAll).Watch(playgroundSelector, labels.Everything(), "")
+	if err != nil {
+		return err
+	}
+	defer rcWatch.Stop()
+
+	eventWatch, err := client.Events(api.NamespaceAll).Watch(labels.Everything(), labels.Everything(), "")
+	if err != nil {
+		return err
+	}
+	defer eventWatch.Stop()
+
+	for {
+		select {
+		case <-exit:
+			return nil
+		case e, ok := <-podWatch.ResultChan():
+			if !ok {
+				return errors.New("Pod watch closed")
+			}
+			if pod, ok := e.Object.(*api.Pod); ok {
+				if e.Type == watch.Deleted {
+					w.forget(pod)
+					continue
+				}
+				w.pod(pod, ch)
+			}
+		case e, ok := <-rcWatch.ResultChan():
+			if !ok {
+				return errors.New("Replication controller watch closed")
+			}
+			if rc, ok := e.Object.(*api.ReplicationController); ok {
+				w.replCtrl(e.Type, rc, ch)
+			}
+		case e, ok := <-eventWatch.ResultChan():
+			if !ok {
+				return errors.New("Event watch closed")
+			}
+			if ev, ok := e.Object.(*api.Event); ok {
+				w.event(ev, ch)
+			}
+		}
+	}
+}
+
+func (w *watcher) forget(pod *api.Pod) {
+	w.Lock()
+	delete(w.pods, pod.Name)
+	for _, cs := range pod.Status.ContainerStatuses {
+		delete(w.restarts, pod.Name+"/"+cs.Name)
+	}
+	w.Unlock()
+}
+
+// oomKilled returns true if a container was killed for running out
+// of memory since the pod was last seen. The last termination stays
+// after the container recovers so it only counts on a new restart.
+func (w *watcher) oomKilled(pod *api.Pod, cs api.ContainerStatus) bool {
+	if t := cs.State.Termination; t != nil {
+		return t.Reason == "OOMKilled"
+	}
+
+	key := pod.Name + "/" + cs.Name
+
+	w.Lock()
+	seen, ok := w.restarts[key]
+	w.restarts[key] = cs.RestartCount
+	w.Unlock()
+
+	t := cs.LastTerminationState.Termination
+	return ok && seen != cs.RestartCount && t != nil && t.Reason == "OOMKilled"
+}
+
+func (w *watcher) pod(pod *api.Pod, ch chan<- *runtime.StateChange) {
+	name, ok := pod.Labels["name"]
+	if !ok {
+		return
+	}
+
+	w.Lock()
+	w.pods[pod.Name] = name
+	w.Unlock()
+
+	if change := w.podState(pod); change != nil {
+		change.Name = name
+		ch <- change
+	}
+}
+
+func (w *watcher) replCtrl(t watch.EventType, rc *api.ReplicationController, ch chan<- *runtime.StateChange) {
+	name, ok := rc.Labels["name"]
+	if !ok {
+		return
+	}
+
+	if t == watch.Deleted || rc.Spec.Replicas == 0 {
+		ch <- &runtime.StateChange{
+			Name:    name,
+			State:   runtime.StateStopped,
+			Reason:  "Replication controller",
+			Message: "No replicas scheduled",
+		}
+	}
+}
+
+func (w *watcher) event(ev *api.Event, ch chan<- *runtime.StateChange) {
+	if ev.InvolvedObject.Kind != "Pod" {
+		return
+	}
+
+	w.RLock()
+	name, ok := w.pods[ev.InvolvedObject.Name]
+	w.RUnlock()
+	if !ok {
+		return
+	}
+
+	var state string
+	switch reason := strings.ToLower(ev.Reason); {
+	case strings.Contains(reason, "failedscheduling"):
+		state = runtime.StatePending
+	case strings.Contains(reason, "pull") && strings.Contains(reason, "fail"):
+		state = runtime.StateImagePullError
+	case strings.Contains(reason, "backoff"):
+		state = runtime.StateCrashLooping
+	default:
+		return
+	}
+
+	ch <- &runtime.StateChange{
+		Name:    name,
+		State:   state,
+		Reason:  ev.Reason,
+		Message: ev.Message,
+	}
+}
+
+// podState maps the status of a pod to an app state. Running but
+// not ready pods are left to the health checks.
+func (w *watcher) podState(pod *api.Pod) *runtime.StateChange {
+	// every container's restarts are recorded before reporting any
+	var oom []string
+	for _, cs := range pod.Status.ContainerStatuses {
+		if w.oomKilled(pod, cs) {
+			oom = append(oom, cs.Name)
+		}
+	}
+
+	if len(oom) > 0 {
+		return &runtime.StateChange{
+			State:   runtime.StateOOMKilled,
+			Reason:  "OOMKilled",
+			Message: fmt.Sprintf("Container %s ran out of memory", strings.Join(oom, ", ")),
+		}
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if waiting := cs.State.Waiting; waiting != nil {
+			switch {
+			case strings.Contains(waiting.Reason, "Image") || strings.Contains(waiting.Reason, "Pull"):
+				return &runtime.StateChange{
+					State:   runtime.StateImagePullError,
+					Reason:  waiting.Reason,
+					Message: fmt.Sprintf("Could not pull image %s", cs.Image),
+				}
+			case cs.RestartCount > 0:
+				return &runtime.StateChange{
+					State:   runtime.StateCrashLooping,
+					Reason:  waiting.Reason,
+					Message: fmt.Sprintf("Container %s restarted %d times", cs.Name, cs.RestartCount),
+				}
+			}
+		}
+	}
+
+	switch pod.Status.Phase {
+	case api.PodPending:
+		return &runtime.StateChange{
+			State:   runtime.StatePending,
+			Reason:  "Pod pending",
+			Message: pod.Status.Message,
+		}
+	case api.PodRunning:
+		if !podReady(pod) {
+			return nil
+		}
+		return &runtime.StateChange{
+			State:   runtime.StateRunning,
+			Reason:  "Pod running",
+			Message: fmt.Sprintf("Pod %s ready on %s", pod.Name, pod.Status.Host),
+		}
+	case api.PodFailed:
+		return &runtime.StateChange{
+			State:   runtime.StateFailed,
+			Reason:  "Pod failed",
+			Message: pod.Status.Message,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package metrics counts requests to apps so they can be
+// scaled on request rate. Counts are kept in per minute buckets.
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	prefix = "playground:metrics:"
+	bucket = time.Minute
+	// buckets are kept for an hour
+	retention = time.Hour
+	pool      = newPool()
+)
+
+func newPool() *redis.Pool {
+	host := os.Getenv("PLAYGROUND_REDIS_SERVICE_HOST")
+	port := os.Getenv("PLAYGROUND_REDIS_SERVICE_PORT")
+
+	if len(host) == 0 {
+		host = "127.0.0.1"
+	}
+
+	if len(port) == 0 {
+		port = "6379"
+	}
+
+	return redis.NewPool(func() (redis.Conn, error) {
+		return redis.Dial("tcp", host+":"+port)
+	}, 5)
+}
+
+func bucketKey(app string, t time.Time) string {
+	return fmt.Sprintf("%srequests:%s:%d", prefix, app, t.Truncate(bucket).Unix())
+}
+
+// Hit records a request to an app
+func Hit(app string) error {
+	conn := pool.Get()
+	defer conn.Close()
+
+	now := time.Now()
+	key := bucketKey(app, now)
+
+	conn.Send("MULTI")
+	conn.Send("INCR", key)
+	conn.Send("EXPIRE", key, int(retention.Seconds()))
+	conn.Send("SET", prefix+"last:"+app, now.Unix())
+	conn.Send("INCR", prefix+"total:"+app)
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// Rate returns the requests per second to an app over the window
+func Rate(app string, window time.Duration) (float64, error) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	now := time.Now()
+
+	var args []interface{}
+	for t := now.Add(-window); !t.After(now); t = t.Add(bucket) {
+		args = append(args, bucketKey(app, t))
+	}
+
+	counts, err := redis.Ints(conn.Do("MGET", args...))
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for _, c := range counts {
+		total += c
+	}
+
+	return float64(total) / window.Seconds(), nil
+}
+
+// LastHit returns the time of the last request to an app
+func LastHit(app string) (time.Time, error) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	ts, err := redis.Int64(conn.Do("GET", prefix+"last:"+app))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// Count returns the total number of requests recorded for an app
+func Count(app string) (int64, error) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	n, err := redis.Int64(conn.Do("GET", prefix+"total:"+app))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/domain"
+	"github.com/myodc/playground-server/server/runtime"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+var (
+	// how long routes and endpoints are reused for without
+	// reading them from the store again
+	cacheTTL = 5 * time.Second
+
+	cacheMtx sync.RWMutex
+	cache    = make(map[string]*cacheEntry)
+)
+
+func cacheGet(key string) (interface{}, bool) {
+	cacheMtx.RLock()
+	defer cacheMtx.RUnlock()
+
+	e, ok := cache[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func cacheSet(key string, value interface{}) {
+	cacheMtx.Lock()
+	defer cacheMtx.Unlock()
+
+	// drop expired entries as new ones are added
+	now := time.Now()
+	for k, e := range cache {
+		if now.After(e.expires) {
+			delete(cache, k)
+		}
+	}
+
+	cache[key] = &cacheEntry{value, now.Add(cacheTTL)}
+}
+
+func cacheDel(key string) {
+	cacheMtx.Lock()
+	delete(cache, key)
+	cacheMtx.Unlock()
+}
+
+// lookup returns the app a custom domain routes to. Hosts which
+// are not custom domains are cached too since every request to the
+// server is matched.
+func lookup(host string) (string, bool) {
+	if id, ok := cacheGet("domain:" + host); ok {
+		return id.(string), len(id.(string)) > 0
+	}
+
+	id, _ := domain.Lookup(host)
+	cacheSet("domain:"+host, id)
+	return id, len(id) > 0
+}
+
+// endpoint returns where a running app is reached
+func endpoint(id string) (*runtime.Service, error) {
+	if service, ok := cacheGet("endpoint:" + id); ok {
+		return service.(*runtime.Service), nil
+	}
+
+	service, err := app.Endpoint(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSet("endpoint:"+id, service)
+	return service, nil
+}
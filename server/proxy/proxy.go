@@ -0,0 +1,147 @@
+// Package proxy routes requests to running apps by host,
+// <app>.<domain>, or by path, /proxy/<app>/.
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/domain"
+	"github.com/myodc/playground-server/server/metrics"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	pathPrefix = "/proxy/"
+	// how long a request is held while an idle app wakes
+	wakeTimeout = 2 * time.Minute
+)
+
+// Enabled returns true if PLAYGROUND_PROXY is set
+func Enabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("PLAYGROUND_PROXY"))
+	return enabled
+}
+
+// Domain is the domain apps are served under by host
+func Domain() string {
+	return os.Getenv("PLAYGROUND_PROXY_DOMAIN")
+}
+
+// URL returns where an app is served, by host when a domain is set
+func URL(id string) string {
+	if len(Domain()) > 0 {
+		return "http://" + id + "." + Domain()
+	}
+	return pathPrefix + id + "/"
+}
+
+func hostname(r *http.Request) string {
+	host := r.Host
+	if i := strings.LastIndex(host, ":"); i > 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// Match returns the app a request is for by host, if any.
+// Hostnames of the server are left to the api. Hosts under the
+// proxy domain are never looked up as custom domains so they
+// can't be claimed by another app.
+func Match(r *http.Request) (string, bool) {
+	host := hostname(r)
+
+	if domain.Server(host) {
+		return "", false
+	}
+
+	if len(Domain()) > 0 && (host == Domain() || strings.HasSuffix(host, "."+Domain())) {
+		id := strings.TrimSuffix(host, "."+Domain())
+		if len(id) == 0 || id == host || strings.Contains(id, ".") {
+			return "", false
+		}
+		return id, true
+	}
+
+	return lookup(host)
+}
+
+// ServeHost proxies a request routed by host
+func ServeHost(w http.ResponseWriter, r *http.Request) {
+	id, ok := Match(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	serve(id, w, r)
+}
+
+// ServePath proxies a request routed by path, stripping the prefix
+func ServePath(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, pathPrefix)
+	parts := strings.SplitN(path, "/", 2)
+
+	id := parts[0]
+	if len(id) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// redirect so relative urls resolve under the app
+	if len(parts) == 1 {
+		http.Redirect(w, r, pathPrefix+id+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	r.URL.Path = "/" + parts[1]
+	serve(id, w, r)
+}
+
+func serve(id string, w http.ResponseWriter, r *http.Request) {
+	// apps with an endpoint are up, only others are woken
+	service, err := endpoint(id)
+	if err == nil {
+		if err := metrics.Hit(id); err != nil {
+			log.Errorf("Error recording request for %s: %v", id, err)
+		}
+	} else {
+		// records the request and starts the app if idle
+		if err := app.Wake(id, wakeTimeout); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		service, err = endpoint(id)
+		if err != nil {
+			http.Error(w, "App not running", http.StatusBadGateway)
+			return
+		}
+	}
+
+	target := fmt.Sprintf("%s:%d", service.IP, service.Port)
+
+	if isWebsocket(r) {
+		if err := tunnel(target, w, r); err != nil {
+			cacheDel("endpoint:" + id)
+			log.Errorf("Error proxying websocket to %s: %v", id, err)
+		}
+		return
+	}
+
+	rp := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: target})
+	rp.FlushInterval = 100 * time.Millisecond
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// the app may have stopped or moved since it was cached
+		cacheDel("endpoint:" + id)
+		log.Errorf("Error proxying to %s: %v", id, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	rp.ServeHTTP(w, r)
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/myodc/playground-server/server/metrics"
+)
+
+// Stats are the requests proxied to an app
+type Stats struct {
+	AppId       string
+	Requests    int64
+	Rate        float64
+	LastRequest time.Time
+}
+
+// AppStats returns the request stats of an app
+func AppStats(id string) (*Stats, error) {
+	count, err := metrics.Count(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := metrics.Rate(id, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := metrics.LastHit(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stats{
+		AppId:       id,
+		Requests:    count,
+		Rate:        rate,
+		LastRequest: last,
+	}, nil
+}
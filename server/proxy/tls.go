@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/myodc/playground-server/server/domain"
+)
+
+// Challenge answers domain verification and ACME http-01
+// challenges, returning false if the request is neither
+func Challenge(w http.ResponseWriter, r *http.Request) bool {
+	switch {
+	case strings.HasPrefix(r.URL.Path, domain.ACMEChallengePath):
+		token := strings.TrimPrefix(r.URL.Path, domain.ACMEChallengePath)
+		response, ok := domain.ACMEChallenge(token)
+		if !ok {
+			http.NotFound(w, r)
+			return true
+		}
+		fmt.Fprint(w, response)
+		return true
+	case strings.HasPrefix(r.URL.Path, domain.ChallengePath):
+		// hosts served by an app are answered by the app
+		if _, ok := Match(r); ok {
+			return false
+		}
+		token := strings.TrimPrefix(r.URL.Path, domain.ChallengePath)
+		response, ok := domain.Challenge(hostname(r), token)
+		if !ok {
+			http.NotFound(w, r)
+			return true
+		}
+		fmt.Fprint(w, response)
+		return true
+	}
+
+	return false
+}
+
+// ListenTLS serves h over TLS selecting custom domain
+// certificates by SNI. Blocking.
+func ListenTLS(address string, h http.Handler) error {
+	srv := &http.Server{
+		Addr:    address,
+		Handler: h,
+		TLSConfig: &tls.Config{
+			GetCertificate: domain.GetCertificate,
+		},
+	}
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+func isWebsocket(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") &&
+		strings.ToLower(r.Header.Get("Upgrade")) == "websocket"
+}
+
+// tunnel forwards the upgrade request to the app and then
+// copies bytes in both directions until either side closes
+func tunnel(target string, w http.ResponseWriter, r *http.Request) error {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Websockets not supported", http.StatusInternalServerError)
+		return errors.New("Response does not support hijacking")
+	}
+
+	backend, err := net.Dial("tcp", target)
+	if err != nil {
+		http.Error(w, "App not reachable", http.StatusBadGateway)
+		return err
+	}
+	defer backend.Close()
+
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := r.Write(backend); err != nil {
+		return err
+	}
+
+	errc := make(chan error, 2)
+	cp := func(dst io.Writer, src io.Reader) {
+		_, err := io.Copy(dst, src)
+		errc <- err
+	}
+
+	// the client may have sent data already read into the buffer
+	go cp(backend, buf)
+	go cp(client, backend)
+
+	return <-errc
+}
@@ -0,0 +1,16 @@
+package runtime
+
+import (
+	"sort"
+)
+
+// EnvKeys returns the names of env vars in order so containers
+// are given the same env between deploys
+func EnvKeys(env map[string]string) []string {
+	var keys []string
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"time"
+)
+
+const (
+	HealthHTTP = "http"
+	HealthTCP  = "tcp"
+	HealthExec = "exec"
+)
+
+const (
+	// Instances are running but not yet passing checks
+	Starting  = "starting"
+	Healthy   = "healthy"
+	Unhealthy = "unhealthy"
+)
+
+// HealthCheck is how the health of an app instance is determined.
+// Durations are in seconds.
+type HealthCheck struct {
+	Type    string
+	Path    string
+	Port    int
+	Command []string
+
+	InitialDelay     int
+	Interval         int
+	Timeout          int
+	SuccessThreshold int
+	FailureThreshold int
+}
+
+// Health is the aggregate health of an app's instances
+type Health struct {
+	Status    string
+	Healthy   int
+	Instances int
+	Message   string
+	Checked   time.Time
+}
+
+// Defaults fills in unset thresholds with the kubernetes defaults
+func (h *HealthCheck) Defaults() {
+	if h.Interval <= 0 {
+		h.Interval = 10
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = 1
+	}
+	if h.SuccessThreshold <= 0 {
+		h.SuccessThreshold = 1
+	}
+	if h.FailureThreshold <= 0 {
+		h.FailureThreshold = 3
+	}
+}
@@ -0,0 +1,24 @@
+package runtime
+
+import (
+	"io"
+)
+
+// Job is an app image run to completion rather than as a service
+type Job struct {
+	Image     string
+	Labels    map[string]string
+	Volumes   []Volume
+	Resources *Resources
+	Env       map[string]string
+}
+
+// Runner is implemented by runtimes which can run jobs. Runs are
+// named by the app and a run id unique to the app.
+type Runner interface {
+	// Run blocks until the job exits, writing its output to out,
+	// and returns the exit code
+	Run(name, run string, job *Job, out io.Writer) (int, error)
+	// Kill stops a run, causing Run to return
+	Kill(name, run string) error
+}
@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+type prefixWriter struct {
+	sync.Mutex
+	prefix []byte
+	out    io.Writer
+	buf    bytes.Buffer
+}
+
+// PrefixWriter prefixes each line written with the instance name,
+// used when logs of several instances are aggregated. Close
+// writes any trailing partial line.
+func PrefixWriter(instance string, out io.Writer) io.WriteCloser {
+	return &prefixWriter{
+		prefix: []byte("[" + instance + "] "),
+		out:    out,
+	}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.buf.Write(b)
+
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := append(append([]byte{}, p.prefix...), p.buf.Next(i+1)...)
+		if _, err := p.out.Write(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (p *prefixWriter) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.buf.Len() == 0 {
+		return nil
+	}
+
+	line := append(append([]byte{}, p.prefix...), p.buf.Bytes()...)
+	p.buf.Reset()
+	_, err := p.out.Write(append(line, '\n'))
+	return err
+}
+
+// Aggregate reads the logs of several instances with fn, prefixing
+// lines with the instance name. Followed logs are read concurrently
+// since they don't end.
+func Aggregate(instances []string, follow bool, out io.Writer, fn func(instance string, w io.Writer) error) error {
+	if len(instances) == 1 {
+		return fn(instances[0], out)
+	}
+
+	// serialise writes from concurrent readers
+	out = &lockedWriter{w: out}
+
+	read := func(instance string) error {
+		pw := PrefixWriter(instance, out)
+		err := fn(instance, pw)
+		pw.Close()
+		return err
+	}
+
+	if !follow {
+		for _, instance := range instances {
+			if err := read(instance); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make(chan error, len(instances))
+	for _, instance := range instances {
+		go func(instance string) {
+			errs <- read(instance)
+		}(instance)
+	}
+
+	var err error
+	for i := 0; i < len(instances); i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.w.Write(b)
+}
@@ -0,0 +1,35 @@
+package runtime
+
+const (
+	ProtocolTCP  = "TCP"
+	ProtocolUDP  = "UDP"
+	ProtocolHTTP = "HTTP"
+	ProtocolGRPC = "GRPC"
+)
+
+// Port is a named container port. Public ports are exposed
+// outside the runtime, others only to other apps.
+type Port struct {
+	Name          string
+	ContainerPort int
+	Protocol      string
+	Public        bool
+}
+
+// ServicePort is where a port of an app can be reached
+type ServicePort struct {
+	Name     string
+	Port     int
+	Protocol string
+	Public   bool
+	// Port on the docker host, docker runtime only
+	HostPort int `json:",omitempty"`
+}
+
+// Transport returns the transport protocol of a port
+func (p *Port) Transport() string {
+	if p.Protocol == ProtocolUDP {
+		return ProtocolUDP
+	}
+	return ProtocolTCP
+}
@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resources are the CPU and memory a container is guaranteed
+// (requests) and may not exceed (limits). Blank values are unset.
+type Resources struct {
+	Requests ResourceList
+	Limits   ResourceList
+}
+
+// ResourceList holds quantities in the kubernetes format. CPU is
+// in cores, e.g. 0.5 or 500m, and memory in bytes, e.g. 256Mi or 1G.
+type ResourceList struct {
+	CPU    string
+	Memory string
+}
+
+var memoryUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+}
+
+// ParseCPU returns a CPU quantity in millicores, 0 if blank
+func ParseCPU(s string) (int64, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(s, "m") {
+		m, err := strconv.ParseInt(strings.TrimSuffix(s, "m"), 10, 64)
+		if err != nil || m < 0 {
+			return 0, fmt.Errorf("Invalid CPU quantity %s", s)
+		}
+		return m, nil
+	}
+
+	cores, err := strconv.ParseFloat(s, 64)
+	if err != nil || cores < 0 {
+		return 0, fmt.Errorf("Invalid CPU quantity %s", s)
+	}
+	return int64(cores * 1000), nil
+}
+
+// ParseMemory returns a memory quantity in bytes, 0 if blank
+func ParseMemory(s string) (int64, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+
+	num, mult := s, int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			num, mult = strings.TrimSuffix(s, unit.suffix), unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid memory quantity %s", s)
+	}
+	return n * mult, nil
+}
+
+// FormatCPU formats millicores as a CPU quantity
+func FormatCPU(m int64) string {
+	if m == 0 {
+		return ""
+	}
+	if m%1000 == 0 {
+		return strconv.FormatInt(m/1000, 10)
+	}
+	return strconv.FormatInt(m, 10) + "m"
+}
+
+// FormatMemory formats bytes as a memory quantity in the
+// largest binary unit it is a multiple of
+func FormatMemory(b int64) string {
+	if b == 0 {
+		return ""
+	}
+	for i := 3; i >= 0; i-- {
+		unit := memoryUnits[i]
+		if b%unit.bytes == 0 {
+			return strconv.FormatInt(b/unit.bytes, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(b, 10)
+}
@@ -0,0 +1,77 @@
+// Package runtime defines where long running apps are deployed.
+// Implementations live in the kubernetes and docker packages.
+package runtime
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNoInstances is returned by Scale when an app has no instances
+// to scale from, it is created again with the new count instead
+var ErrNoInstances = errors.New("No instances to scale")
+
+// Runtime deploys and manages the containers of an app
+type Runtime interface {
+	Create(name string, config *ContainerConfig) (*Service, error)
+	Update(name string, config *ContainerConfig, out io.Writer) error
+	Delete(name string) error
+	Logs(name string, opts *LogOptions, out io.Writer) error
+	Health(name string) (*Health, error)
+	Instances(name string) ([]*Instance, error)
+	Scale(name string, replicas int) error
+	DeleteVolumes(name string) error
+}
+
+type ContainerConfig struct {
+	Image string
+	// The primary port, also listed in Ports
+	ContainerPort int
+	Ports         []Port
+	NumInstances  int
+	Labels        map[string]string
+	HealthCheck   *HealthCheck
+	Volumes       []Volume
+	Resources     *Resources
+	Env           map[string]string
+}
+
+// Service is where an app can be reached. IP and Port
+// are of the primary port.
+type Service struct {
+	Name   string
+	IP     string
+	Port   int
+	Ports  []ServicePort
+	Status string
+}
+
+// Instance is a single replica of an app
+type Instance struct {
+	Name      string
+	Host      string
+	IP        string
+	Phase     string
+	Ready     bool
+	Restarts  int
+	Started   time.Time
+	Image     string
+	Resources *Resources
+}
+
+// LogOptions selects the logs to read. A blank instance
+// reads the logs of all instances.
+type LogOptions struct {
+	Instance  string
+	Container string
+	// Stream new lines until the writer fails
+	Follow bool
+	// Number of lines from the end, 0 for all
+	Tail int
+	// Only lines since this time
+	Since      time.Time
+	Timestamps bool
+	// Logs of the previous terminated container
+	Previous bool
+}
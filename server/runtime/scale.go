@@ -0,0 +1,29 @@
+package runtime
+
+// Autoscale is the replica range of an app and the target
+// utilisation it is scaled to
+type Autoscale struct {
+	MinInstances int
+	MaxInstances int
+	// Average CPU utilisation percent of the instances
+	TargetCPU int
+	// Requests per second per instance
+	TargetRequestRate float64
+}
+
+// Usage is the resource usage of an app averaged over its instances
+type Usage struct {
+	CPU       float64
+	Instances int
+}
+
+// Metrics is implemented by runtimes which can report resource usage
+type Metrics interface {
+	Usage(name string) (*Usage, error)
+}
+
+// Autoscaler is implemented by runtimes which scale apps
+// themselves, in which case the server control loop defers to them
+type Autoscaler interface {
+	Autoscale(name string, policy *Autoscale) error
+}
@@ -0,0 +1,11 @@
+package runtime
+
+// Volume is named persistent storage mounted into an app's
+// containers. It outlives the containers and is only removed
+// by DeleteVolumes.
+type Volume struct {
+	Name string
+	// Requested size as a quantity, e.g. 1Gi or 500Mi
+	Size      string
+	MountPath string
+}
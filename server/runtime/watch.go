@@ -0,0 +1,27 @@
+package runtime
+
+// States of an app observed from the runtime
+const (
+	StatePending        = "Pending"
+	StateRunning        = "Running"
+	StateCrashLooping   = "CrashLooping"
+	StateOOMKilled      = "OOMKilled"
+	StateImagePullError = "ImagePullError"
+	StateFailed         = "Failed"
+	StateStopped        = "Stopped"
+)
+
+// StateChange is an observed change in the state of an app
+type StateChange struct {
+	Name    string
+	State   string
+	Reason  string
+	Message string
+}
+
+// Watcher is implemented by runtimes which can report state
+// changes of the apps they run. Watch blocks until exit is closed
+// or the watch fails.
+type Watcher interface {
+	Watch(ch chan<- *StateChange, exit <-chan bool) error
+}
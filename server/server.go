@@ -3,8 +3,15 @@ package server
 import (
 	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/myodc/playground-server/server/app"
+	"github.com/myodc/playground-server/server/cache"
+	"github.com/myodc/playground-server/server/docker"
+	"github.com/myodc/playground-server/server/domain"
 	"github.com/myodc/playground-server/server/handler"
+	"github.com/myodc/playground-server/server/proxy"
 )
 
 type server struct{}
@@ -20,20 +27,85 @@ func init() {
 	http.HandleFunc("/apps/create", handler.Create)
 	http.HandleFunc("/apps/delete", handler.Delete)
 	http.HandleFunc("/apps/update", handler.Update)
+	http.HandleFunc("/apps/patch", handler.Patch)
 	http.HandleFunc("/apps/read", handler.Read)
+	http.HandleFunc("/apps/apply", handler.Apply)
+	http.HandleFunc("/apps/export", handler.Export)
 
 	// Deployment
 	http.HandleFunc("/apps/logs", handler.Logs)
 	http.HandleFunc("/apps/build", handler.Build)
 	http.HandleFunc("/apps/status", handler.Status)
+	http.HandleFunc("/apps/status/history", handler.StatusHistory)
+	http.HandleFunc("/apps/instances", handler.Instances)
 	http.HandleFunc("/apps/start", handler.Start)
 	http.HandleFunc("/apps/stop", handler.Stop)
+	http.HandleFunc("/apps/scale", handler.Scale)
+	http.HandleFunc("/apps/wake", handler.Wake)
+	http.HandleFunc("/apps/stats", handler.Stats)
+
+	// Jobs
+	http.HandleFunc("/jobs/run", handler.RunJob)
+	http.HandleFunc("/jobs/runs", handler.Runs)
+	http.HandleFunc("/jobs/read", handler.ReadRun)
+	http.HandleFunc("/jobs/kill", handler.KillRun)
+
+	// Stacks
+	http.HandleFunc("/stacks/create", handler.CreateStack)
+	http.HandleFunc("/stacks/update", handler.UpdateStack)
+	http.HandleFunc("/stacks/read", handler.ReadStack)
+	http.HandleFunc("/stacks/list", handler.ListStacks)
+	http.HandleFunc("/stacks/delete", handler.DeleteStack)
+	http.HandleFunc("/stacks/build", handler.BuildStack)
+	http.HandleFunc("/stacks/start", handler.StartStack)
+	http.HandleFunc("/stacks/stop", handler.StopStack)
+
+	// Backing services
+	http.HandleFunc("/services/catalog", handler.Catalog)
+	http.HandleFunc("/services/provision", handler.Provision)
+	http.HandleFunc("/services/list", handler.ListServices)
+	http.HandleFunc("/services/read", handler.ReadService)
+	http.HandleFunc("/services/bind", handler.BindService)
+	http.HandleFunc("/services/unbind", handler.UnbindService)
+	http.HandleFunc("/services/deprovision", handler.Deprovision)
+
+	// Branch previews
+	http.HandleFunc("/previews/hook", handler.PushHook)
+	http.HandleFunc("/previews/create", handler.CreatePreview)
+	http.HandleFunc("/previews/list", handler.ListPreviews)
+	http.HandleFunc("/previews/delete", handler.DeletePreview)
+
+	// Images
+	http.HandleFunc("/images/gc", handler.GC)
+
+	// Custom domains
+	http.HandleFunc("/domains/add", handler.AddDomain)
+	http.HandleFunc("/domains/verify", handler.VerifyDomain)
+	http.HandleFunc("/domains/cert", handler.DomainCert)
+	http.HandleFunc("/domains/list", handler.ListDomains)
+	http.HandleFunc("/domains/delete", handler.DeleteDomain)
 
 	// Event stream
 	http.HandleFunc("/events", handler.Events)
+
+	// Proxy to apps by path
+	if proxy.Enabled() {
+		http.HandleFunc("/proxy/", proxy.ServePath)
+	}
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Proxy to apps by host
+	if proxy.Enabled() {
+		if proxy.Challenge(w, r) {
+			return
+		}
+		if _, ok := proxy.Match(r); ok {
+			proxy.ServeHost(w, r)
+			return
+		}
+	}
+
 	if origin := r.Header.Get("Origin"); origin != "" {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
@@ -49,6 +121,49 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func Run(address string) {
+	// the runtime apps are deployed to
+	if err := app.Init(); err != nil {
+		log.Fatalf("Error setting up runtime: %v", err)
+	}
+
+	// keep build caches within the disk budget
+	go cache.Run(time.Minute * 10)
+
+	// keep app status in line with the runtime
+	go app.Reconcile()
+
+	// scale apps with an autoscale policy
+	go app.Autoscale(time.Second * 30)
+
+	// requests are only recorded by the proxy, without it
+	// idle timeouts and preview TTLs would expire busy apps
+	if proxy.Enabled() {
+		// stop apps idle past their idle timeout
+		go app.Reap(time.Minute)
+
+		// remove branch previews past their TTL
+		go app.ExpirePreviews(time.Minute * 10)
+	}
+
+	// trigger job apps on their schedule
+	go app.Schedule(time.Second * 10)
+
+	// remove old releases and images of deleted apps
+	go docker.RunGC(time.Hour, app.Images)
+
+	// renew certificates issued by ACME
+	go domain.Renew(time.Hour * 12)
+
+	// serve custom domains over TLS
+	if addr := os.Getenv("PLAYGROUND_PROXY_TLS_ADDR"); len(addr) > 0 && proxy.Enabled() {
+		go func() {
+			log.Printf("Starting TLS proxy on %s", addr)
+			if err := proxy.ListenTLS(addr, &server{}); err != nil {
+				log.Printf("TLS proxy error: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Starting server on %s", address)
 	if err := http.ListenAndServe(address, &server{}); err != nil {
 		panic(err.Error())
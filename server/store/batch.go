@@ -0,0 +1,137 @@
+package store
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Batch is a set of writes applied atomically in a MULTI/EXEC
+// transaction, or a script by ExecIf. Nothing is written until
+// Exec or ExecIf.
+type Batch struct {
+	cmds []command
+}
+
+type command struct {
+	name string
+	args []interface{}
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+func (b *Batch) add(name string, args ...interface{}) {
+	b.cmds = append(b.cmds, command{name, args})
+}
+
+// Put adds setting the value of a key to the batch
+func (b *Batch) Put(namespace, key string, value []byte) *Batch {
+	b.add("ZADD", zprefix+namespace, time.Now().UnixNano(), key)
+	b.add("HSET", namespace, key, value)
+	return b
+}
+
+// Del adds removing a key to the batch
+func (b *Batch) Del(namespace, key string) *Batch {
+	b.add("ZREM", zprefix+namespace, key)
+	b.add("HDEL", namespace, key)
+	return b
+}
+
+// Drop adds removing a namespace and its index to the batch
+func (b *Batch) Drop(namespace string) *Batch {
+	b.add("DEL", zprefix+namespace)
+	b.add("DEL", namespace)
+	return b
+}
+
+// Exec applies the writes in the batch
+func (b *Batch) Exec() error {
+	if len(b.cmds) == 0 {
+		return nil
+	}
+
+	initStore()
+	conn := store.Get()
+	defer conn.Close()
+
+	return b.exec(conn)
+}
+
+// casScript applies the writes in a batch if the field ARGV[1] of
+// the hash KEYS[1] is unset, ARGV[2] is 1, or equal to ARGV[3].
+// Each write follows as its key in KEYS, its command and the
+// number of args in ARGV, then the args. Only the field compared
+// is checked, unlike a WATCH of the whole hash.
+var casScript = redis.NewScript(-1, `
+local current = redis.call('HGET', KEYS[1], ARGV[1])
+if ARGV[2] == '1' then
+	if current then
+		return 0
+	end
+elseif current ~= ARGV[3] then
+	return 0
+end
+
+local a = 4
+for k = 2, #KEYS do
+	local n = tonumber(ARGV[a + 1])
+	redis.call(ARGV[a], KEYS[k], unpack(ARGV, a + 2, a + 1 + n))
+	a = a + 2 + n
+end
+return 1
+`)
+
+// ExecIf applies the writes only if the value of a key is still
+// old, nil for a key which must not exist yet. It returns false
+// and writes nothing if the value has changed. The check and the
+// writes run as one script so they are atomic.
+func (b *Batch) ExecIf(namespace, key string, old []byte) (bool, error) {
+	initStore()
+	conn := store.Get()
+	defer conn.Close()
+
+	missing := "0"
+	if old == nil {
+		missing = "1"
+	}
+
+	keys := []interface{}{namespace}
+	args := []interface{}{key, missing, old}
+	for _, cmd := range b.cmds {
+		keys = append(keys, cmd.args[0])
+		args = append(args, cmd.name, len(cmd.args)-1)
+		args = append(args, cmd.args[1:]...)
+	}
+
+	keysAndArgs := append([]interface{}{len(keys)}, keys...)
+	keysAndArgs = append(keysAndArgs, args...)
+
+	ok, err := redis.Bool(casScript.Do(conn, keysAndArgs...))
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (b *Batch) exec(conn redis.Conn) error {
+	conn.Send("MULTI")
+	for _, cmd := range b.cmds {
+		conn.Send(cmd.name, cmd.args...)
+	}
+
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+
+	for _, reply := range replies {
+		if err, ok := reply.(redis.Error); ok {
+			return err
+		}
+	}
+
+	return nil
+}
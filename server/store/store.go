@@ -3,7 +3,6 @@ package store
 import (
 	"errors"
 	"os"
-	"time"
 
 	"github.com/garyburd/redigo/redis"
 )
@@ -56,30 +55,14 @@ func Get(namespace, key string) ([]byte, error) {
 	return b, err
 }
 
+// Put sets the value of a key, atomically with its index entry
 func Put(namespace, key string, value []byte) error {
-	initStore()
-	conn := store.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("ZADD", zprefix+namespace, time.Now().UnixNano(), key)
-	if err != nil {
-		return err
-	}
-	_, err = conn.Do("HSET", namespace, key, value)
-	return err
+	return NewBatch().Put(namespace, key, value).Exec()
 }
 
+// Del removes a key, atomically with its index entry
 func Del(namespace, key string) error {
-	initStore()
-	conn := store.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("ZREM", zprefix+namespace, key)
-	if err != nil {
-		return err
-	}
-	_, err = conn.Do("HDEL", namespace, key)
-	return err
+	return NewBatch().Del(namespace, key).Exec()
 }
 
 func Range(namespace string, offset, limit int) ([][]byte, error) {